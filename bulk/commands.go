@@ -37,30 +37,6 @@ func panicOnErr(err error) {
 	}
 }
 
-// isFalsey returns if a value is falsey, such as `0`, `""`, `[]any{}`, etc.
-// Empty slices and maps are considered falsey.
-func isFalsey(v any) bool {
-	switch t := v.(type) {
-	case bool:
-		return !t
-	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
-		return t == 0
-	case float32, float64:
-		return t == 0.0
-	case string:
-		return len(t) == 0
-	case []byte:
-		return len(t) == 0
-	case []any:
-		return len(t) == 0
-	case map[string]any:
-		return len(t) == 0
-	case map[any]any:
-		return len(t) == 0
-	}
-	return false
-}
-
 // newInterpreter creates a new mexpr interpreter, optionally with type
 // checking if a JSON Schema is available to describe the structure of the
 // input. Parse errors are logged as warnings since there could be false
@@ -162,7 +138,7 @@ func collectFiles(meta *Meta, args []string, match string, includeDeleted bool)
 			b, _ := afero.ReadFile(afs, path)
 			json.Unmarshal(b, &v)
 			result, err := i.Run(v)
-			if err != nil || result == nil || isFalsey(result) {
+			if err != nil || result == nil || cli.IsFalsey(result) {
 				// Skip!
 				continue
 			}
@@ -368,7 +344,7 @@ func Init(cmd *cobra.Command) {
 					b, err := afero.ReadFile(afs, path)
 					panicOnErr(err)
 					if err := json.Unmarshal(b, &content); err == nil {
-						if res, _, err := shorthand.GetPath(filter, content, shorthand.GetOptions{}); err == nil && !isFalsey(res) {
+						if res, _, err := shorthand.GetPath(filter, content, shorthand.GetOptions{}); err == nil && !cli.IsFalsey(res) {
 							fmt.Fprintln(cli.Stdout, path)
 							b, _ := json.MarshalIndent(res, "", "  ")
 							if viper.GetBool("color") {
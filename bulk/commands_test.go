@@ -496,9 +496,9 @@ func TestPushFailure(t *testing.T) {
 }
 
 func TestFalsey(t *testing.T) {
-	for _, item := range []any{false, 0, 0.0, "", []byte{}, []any{}, map[string]any{}, map[any]any{}} {
+	for _, item := range []any{false, 0, int8(0), uint(0), 0.0, float32(0), "", []byte{}, []any{}, map[string]any{}, map[any]any{}} {
 		t.Run(fmt.Sprintf("%T-%+v", item, item), func(t *testing.T) {
-			require.True(t, isFalsey(item))
+			require.True(t, cli.IsFalsey(item))
 		})
 	}
 }
@@ -205,8 +205,7 @@ func Load(entrypoint string, root *cobra.Command) (API, error) {
 	// We will almost never be in a situation where we don't want to use
 	// the parsed API cache, but do want to use a cached response from
 	// the server.
-	client := &http.Client{Transport: InvalidateCachedTransport()}
-	httpResp, err := MakeRequest(req, WithClient(client), IgnoreCLIParams())
+	httpResp, err := MakeRequest(req, WithoutCache(), IgnoreCLIParams())
 	if err != nil {
 		return API{}, err
 	}
@@ -246,7 +245,7 @@ func Load(entrypoint string, root *cobra.Command) (API, error) {
 			return API{}, err
 		}
 
-		resp, err := MakeRequest(req, WithClient(client), IgnoreCLIParams())
+		resp, err := MakeRequest(req, WithoutCache(), IgnoreCLIParams())
 		if err != nil {
 			return API{}, err
 		}
@@ -41,12 +41,64 @@ type PKCS11Config struct {
 	Label string `json:"label" yaml:"label"`
 }
 
+// ProxyConfig describes an HTTP, HTTPS, or SOCKS5 proxy used to make
+// requests to an API.
+type ProxyConfig struct {
+	URL      string   `json:"url" yaml:"url"`
+	Username string   `json:"username,omitempty" yaml:"username,omitempty"`
+	Password string   `json:"password,omitempty" yaml:"password,omitempty"`
+	NoProxy  []string `json:"no_proxy,omitempty" yaml:"no_proxy,omitempty" mapstructure:"no_proxy"`
+}
+
+// RetryConfig describes when and how to retry failed requests. Unset values
+// fall back to less specific settings, e.g. a profile falls back to the API,
+// which falls back to the global configuration.
+type RetryConfig struct {
+	Retries       *int     `json:"retries,omitempty" yaml:"retries,omitempty"`
+	Backoff       string   `json:"backoff,omitempty" yaml:"backoff,omitempty"`
+	MaxDelay      string   `json:"max_delay,omitempty" yaml:"max_delay,omitempty" mapstructure:"max_delay"`
+	Multiplier    float64  `json:"multiplier,omitempty" yaml:"multiplier,omitempty"`
+	Jitter        *float64 `json:"jitter,omitempty" yaml:"jitter,omitempty"`
+	StatusCodes   []int    `json:"status_codes,omitempty" yaml:"status_codes,omitempty" mapstructure:"status_codes"`
+	NetworkErrors *bool    `json:"network_errors,omitempty" yaml:"network_errors,omitempty" mapstructure:"network_errors"`
+	AllMethods    *bool    `json:"all_methods,omitempty" yaml:"all_methods,omitempty" mapstructure:"all_methods"`
+}
+
+// RateLimitConfig limits how quickly requests are made to an API. Rate
+// limit headers sent by the API are also used to pause before the limit is
+// exhausted.
+type RateLimitConfig struct {
+	Rate  float64 `json:"rate,omitempty" yaml:"rate,omitempty"`
+	Burst int     `json:"burst,omitempty" yaml:"burst,omitempty"`
+}
+
+// CacheConfig describes how responses from an API are cached. Sizes may use
+// units like `KB`, `MB`, or `GB`.
+type CacheConfig struct {
+	Disable bool   `json:"disable,omitempty" yaml:"disable,omitempty"`
+	MinTTL  string `json:"min_ttl,omitempty" yaml:"min_ttl,omitempty" mapstructure:"min_ttl"`
+	MaxSize string `json:"max_size,omitempty" yaml:"max_size,omitempty" mapstructure:"max_size"`
+}
+
+// PaginationConfig describes how to auto-paginate responses whose body is
+// an object rather than a list. Paths use the same shorthand query syntax as
+// `--rsh-filter`, e.g. `body.items` or `headers.X-Next-Cursor`. If neither a
+// next link nor a cursor is set, then the `next` link relation is used.
+type PaginationConfig struct {
+	Items       string `json:"items,omitempty" yaml:"items,omitempty"`
+	Next        string `json:"next,omitempty" yaml:"next,omitempty"`
+	Cursor      string `json:"cursor,omitempty" yaml:"cursor,omitempty"`
+	CursorParam string `json:"cursor_param,omitempty" yaml:"cursor_param,omitempty" mapstructure:"cursor_param"`
+}
+
 // APIProfile contains account-specific API information
 type APIProfile struct {
 	Base    string            `json:"base,omitempty" yaml:"base,omitempty"`
 	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
 	Query   map[string]string `json:"query,omitempty" yaml:"query,omitempty"`
 	Auth    *APIAuth          `json:"auth,omitempty" yaml:"auth,omitempty"`
+	Proxy   *ProxyConfig      `json:"proxy,omitempty" yaml:"proxy,omitempty"`
+	Retry   *RetryConfig      `json:"retry,omitempty" yaml:"retry,omitempty"`
 }
 
 // APIConfig describes per-API configuration options like the base URI and
@@ -56,6 +108,15 @@ type APIConfig struct {
 	Base          string                 `json:"base" yaml:"base"`
 	OperationBase string                 `json:"operation_base,omitempty" yaml:"operation_base,omitempty" mapstructure:"operation_base,omitempty"`
 	SpecFiles     []string               `json:"spec_files,omitempty" yaml:"spec_files,omitempty" mapstructure:"spec_files,omitempty"`
+	Socket        string                 `json:"socket,omitempty" yaml:"socket,omitempty" mapstructure:"socket,omitempty"`
+	Proxy         *ProxyConfig           `json:"proxy,omitempty" yaml:"proxy,omitempty" mapstructure:",omitempty"`
+	Retry         *RetryConfig           `json:"retry,omitempty" yaml:"retry,omitempty" mapstructure:",omitempty"`
+	RateLimit     *RateLimitConfig       `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty" mapstructure:"rate_limit,omitempty"`
+	Cookies       bool                   `json:"cookies,omitempty" yaml:"cookies,omitempty" mapstructure:",omitempty"`
+	Cache         *CacheConfig           `json:"cache,omitempty" yaml:"cache,omitempty" mapstructure:",omitempty"`
+	CompressBody  string                 `json:"compress_body,omitempty" yaml:"compress_body,omitempty" mapstructure:"compress_body,omitempty"`
+	ZstdDict      string                 `json:"zstd_dict,omitempty" yaml:"zstd_dict,omitempty" mapstructure:"zstd_dict,omitempty"`
+	Pagination    *PaginationConfig      `json:"pagination,omitempty" yaml:"pagination,omitempty" mapstructure:",omitempty"`
 	Profiles      map[string]*APIProfile `json:"profiles,omitempty" yaml:"profiles,omitempty" mapstructure:",omitempty"`
 	TLS           *TLSConfig             `json:"tls,omitempty" yaml:"tls,omitempty" mapstructure:",omitempty"`
 }
@@ -201,6 +262,50 @@ func initAPIConfig() {
 		},
 	})
 
+	cookiesCommand := &cobra.Command{
+		Use:   "cookies",
+		Short: "Manage API cookies",
+		Long:  "Show or clear the cookies stored for an API profile when `cookies` is enabled in the API config.",
+	}
+	apiCommand.AddCommand(cookiesCommand)
+
+	cookiesCommand.AddCommand(&cobra.Command{
+		Use:   "show short-name",
+		Short: "Show API cookies",
+		Long:  "Show the unexpired cookies stored for an API in the current profile as JSON/YAML.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			apiName := args[0]
+			if configs[apiName] == nil {
+				panic("API " + apiName + " not found")
+			}
+
+			jar, err := getCookieJar(apiName, viper.GetString("rsh-profile"))
+			if err != nil {
+				panic(fmt.Errorf("Unable to load cookies: %w", err))
+			}
+
+			printStructured(jar.List())
+		},
+	})
+
+	cookiesCommand.AddCommand(&cobra.Command{
+		Use:   "clear short-name",
+		Short: "Clear API cookies",
+		Long:  "Remove all cookies stored for an API in the current profile.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			apiName := args[0]
+			if configs[apiName] == nil {
+				panic("API " + apiName + " not found")
+			}
+
+			if err := clearCookieJar(apiName, viper.GetString("rsh-profile")); err != nil {
+				panic(fmt.Errorf("Unable to clear cookies: %w", err))
+			}
+		},
+	})
+
 	apiCommand.AddCommand(&cobra.Command{
 		Use:   "show short-name",
 		Short: "Show API config",
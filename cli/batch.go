@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// BatchRequest describes one request to make as part of a batch.
+type BatchRequest struct {
+	Name    string            `json:"name,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	URI     string            `json:"uri"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    any               `json:"body,omitempty"`
+}
+
+// BatchResult describes the outcome of one request in a batch.
+type BatchResult struct {
+	Index    int               `json:"index"`
+	Name     string            `json:"name,omitempty"`
+	Method   string            `json:"method"`
+	URI      string            `json:"uri"`
+	Status   int               `json:"status,omitempty"`
+	OK       bool              `json:"ok"`
+	Duration string            `json:"duration"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Body     any               `json:"body,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// readBatch reads request specs from JSON lines. Blank lines are ignored.
+func readBatch(r io.Reader) ([]BatchRequest, error) {
+	requests := []BatchRequest{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var br BatchRequest
+		if err := json.Unmarshal([]byte(text), &br); err != nil {
+			return nil, fmt.Errorf("invalid batch request on line %d: %w", line, err)
+		}
+		if br.URI == "" {
+			return nil, fmt.Errorf("batch request on line %d has no uri", line)
+		}
+		requests = append(requests, br)
+	}
+
+	return requests, scanner.Err()
+}
+
+// newBatchRequest builds the HTTP request for a spec. The method defaults to
+// GET, or POST if there is a body. Bodies which are strings are sent as-is,
+// and anything else is encoded using the `Content-Type` header, which
+// defaults to JSON.
+func newBatchRequest(ctx context.Context, br BatchRequest) (*http.Request, error) {
+	method := strings.ToUpper(br.Method)
+	if method == "" {
+		method = http.MethodGet
+		if br.Body != nil {
+			method = http.MethodPost
+		}
+	}
+
+	contentType := ""
+	for name, value := range br.Headers {
+		if strings.EqualFold(name, "content-type") {
+			contentType = value
+		}
+	}
+
+	var body io.Reader
+	switch b := br.Body.(type) {
+	case nil:
+	case string:
+		body = strings.NewReader(b)
+	default:
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		encoded, err := Marshal(contentType, b)
+		if err != nil {
+			return nil, err
+		}
+		body = strings.NewReader(string(encoded))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fixAddress(br.URI), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range br.Headers {
+		req.Header.Set(name, value)
+	}
+	if body != nil && contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	return req, nil
+}
+
+// doBatchRequest makes one request from a batch. The status is ignored for
+// the exit code, which is set once all requests are done.
+func doBatchRequest(ctx context.Context, index int, br BatchRequest) (result BatchResult) {
+	result = BatchResult{
+		Index: index,
+		Name:  br.Name,
+		URI:   br.URI,
+	}
+
+	start := time.Now()
+	defer func() {
+		// Requests may panic, e.g. for an invalid profile, but that shouldn't
+		// stop the rest of the batch.
+		if err := recover(); err != nil {
+			result.Error = fmt.Sprintf("%v", err)
+		}
+		result.Duration = time.Since(start).Truncate(time.Millisecond).String()
+	}()
+
+	req, err := newBatchRequest(ctx, br)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	result.Method = req.Method
+	result.URI = req.URL.String()
+
+	resp, err := MakeRequest(req, IgnoreStatus())
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	parsed, err := ParseResponse(resp)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	result.Status = parsed.Status
+	result.OK = parsed.Status < 400
+	result.Headers = parsed.Headers
+	result.Body = makeJSONSafe(parsed.Body)
+	if b, ok := result.Body.([]byte); ok && utf8.Valid(b) {
+		result.Body = string(b)
+	}
+
+	return
+}
+
+// runBatch makes the requests with at most `concurrency` running at once,
+// calling `report` with each result as it completes. If `failFast` is set,
+// then no further requests are started after the first failure, and those
+// still running are cancelled & not reported.
+func runBatch(requests []BatchRequest, concurrency int, failFast bool, report func(BatchResult)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sem := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+
+	for i, br := range requests {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			result := doBatchRequest(ctx, i, br)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if ctx.Err() != nil {
+				// Cancelled due to an earlier failure.
+				return
+			}
+			if !result.OK && failFast {
+				cancel()
+			}
+			report(result)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// batch runs the requests in a JSON lines file, or stdin if the filename is
+// `-`, and writes each result as a JSON line. Panics if any request failed
+// without a response, otherwise the exit code is set from the worst failed
+// response status.
+func batch(filename string, concurrency int, failFast bool) {
+	var r io.Reader = Stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	requests, err := readBatch(r)
+	if err != nil {
+		panic(err)
+	}
+
+	failed := 0
+	errored := false
+	worst := 0
+	runBatch(requests, concurrency, failFast, func(result BatchResult) {
+		if !result.OK {
+			failed++
+			if result.Status == 0 {
+				errored = true
+			}
+			worst = max(worst, result.Status)
+		}
+
+		encoded, err := MarshalShort("jsonl", false, result)
+		if err != nil {
+			panic(err)
+		}
+		if useColor {
+			encoded, _ = Highlight("json", encoded)
+		}
+		Stdout.Write(encoded)
+	})
+
+	if failed > 0 {
+		err := fmt.Errorf("%d of %d batch requests failed", failed, len(requests))
+		if errored {
+			panic(err)
+		}
+		LogError("%v", err)
+		setLastStatus(worst)
+	}
+}
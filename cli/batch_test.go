@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestReadBatch(t *testing.T) {
+	requests, err := readBatch(strings.NewReader(`{"uri": "example.com/a"}
+
+{"name": "create", "method": "post", "uri": "example.com/b", "body": {"id": 1}}
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []BatchRequest{
+		{URI: "example.com/a"},
+		{Name: "create", Method: "post", URI: "example.com/b", Body: map[string]any{"id": 1.0}},
+	}, requests)
+
+	_, err = readBatch(strings.NewReader(`{"uri": "example.com/a"}` + "\n{bad"))
+	assert.ErrorContains(t, err, "line 2")
+
+	_, err = readBatch(strings.NewReader(`{"method": "GET"}`))
+	assert.ErrorContains(t, err, "no uri")
+}
+
+func batchServer(t *testing.T, inFlight, maxInFlight *atomic.Int32) *httptest.Server {
+	return jsonServer(t, func(r *http.Request) (int, any) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		if r.URL.Path == "/missing" {
+			return http.StatusNotFound, nil
+		}
+
+		return http.StatusOK, map[string]any{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"type":   r.Header.Get("Content-Type"),
+		}
+	})
+}
+
+func batchResults(t *testing.T, captured string) map[string]BatchResult {
+	results := map[string]BatchResult{}
+	for _, line := range strings.Split(strings.TrimSpace(captured), "\n") {
+		if !strings.HasPrefix(line, "{") {
+			// Log output, e.g. the failure summary.
+			continue
+		}
+		var result BatchResult
+		require.NoError(t, json.Unmarshal([]byte(line), &result))
+		results[result.Name] = result
+	}
+	return results
+}
+
+func TestBatch(t *testing.T) {
+	gock.Off()
+	defer reset(false)
+
+	inFlight := &atomic.Int32{}
+	maxInFlight := &atomic.Int32{}
+	server := batchServer(t, inFlight, maxInFlight)
+
+	filename := writeTestFile(t, "requests.jsonl",
+		`{"name": "a", "uri": "`+server.URL+`/a"}`,
+		`{"name": "b", "uri": "`+server.URL+`/b", "body": {"id": 1}}`,
+		`{"name": "c", "method": "PUT", "uri": "`+server.URL+`/c", "headers": {"Content-Type": "text/plain"}, "body": "hello"}`,
+		`{"name": "d", "uri": "`+server.URL+`/d"}`,
+		`{"name": "e", "uri": "`+server.URL+`/e"}`,
+	)
+
+	reset(false)
+	captured := runNoReset("batch --rsh-concurrency 2 " + filename)
+	results := batchResults(t, captured)
+
+	assert.Len(t, results, 5)
+	assert.Equal(t, int32(2), maxInFlight.Load())
+	assert.Equal(t, 0, GetExitCode())
+
+	assert.True(t, results["a"].OK)
+	assert.Equal(t, 200, results["a"].Status)
+	assert.Equal(t, "GET", results["a"].Method)
+
+	assert.Equal(t, "POST", results["b"].Method)
+	assert.Equal(t, "application/json", results["b"].Body.(map[string]any)["type"])
+
+	assert.Equal(t, "PUT", results["c"].Method)
+	assert.Equal(t, "text/plain", results["c"].Body.(map[string]any)["type"])
+}
+
+func TestBatchFailures(t *testing.T) {
+	gock.Off()
+	defer reset(false)
+
+	inFlight := &atomic.Int32{}
+	maxInFlight := &atomic.Int32{}
+	server := batchServer(t, inFlight, maxInFlight)
+
+	filename := writeTestFile(t, "requests.jsonl",
+		`{"name": "missing", "uri": "`+server.URL+`/missing"}`,
+		`{"name": "ok", "uri": "`+server.URL+`/ok"}`,
+	)
+
+	// All requests run and the exit code reflects the failure.
+	reset(false)
+	lastStatus = 0
+	captured := runNoReset("batch " + filename)
+	results := batchResults(t, captured)
+	assert.Len(t, results, 2)
+	assert.False(t, results["missing"].OK)
+	assert.Equal(t, 404, results["missing"].Status)
+	assert.True(t, results["ok"].OK)
+	assert.Contains(t, captured, "1 of 2 batch requests failed")
+	assert.Equal(t, 4, GetExitCode())
+
+	// No more requests are started after the first failure.
+	reset(false)
+	lastStatus = 0
+	captured = runNoReset("batch --rsh-concurrency 1 --rsh-fail-fast " + filename)
+	results = batchResults(t, captured)
+	assert.Len(t, results, 1)
+	assert.Contains(t, results, "missing")
+	lastStatus = 0
+}
@@ -0,0 +1,546 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// responseCacheDir returns the directory used to cache responses for an API.
+// Responses for requests which don't belong to an API share the top level.
+func responseCacheDir(apiName string) string {
+	dir := viper.GetString("cache-dir")
+	if dir == "" {
+		dir = getCacheDir()
+	}
+
+	dir = filepath.Join(dir, "responses")
+	if apiName != "" {
+		dir = filepath.Join(dir, apiName)
+	}
+
+	return dir
+}
+
+// responseCacheMeta is saved next to each cached response so that entries
+// can be listed. The cache key itself is hashed to create the filename.
+type responseCacheMeta struct {
+	Key string `json:"key"`
+}
+
+// responseCache is an `httpcache.Cache` which stores responses on disk. If a
+// maximum size is set, then the oldest responses are removed to stay below
+// it whenever a new response is stored. If a socket is set, then keys use the
+// socket address rather than the `http://localhost` URL sent over it.
+type responseCache struct {
+	dir     string
+	maxSize int64
+	socket  string
+}
+
+// key returns the key to store a response under.
+func (c *responseCache) key(key string) string {
+	if c.socket == "" {
+		return key
+	}
+
+	method, raw, ok := strings.Cut(key, " ")
+	if !ok {
+		method, raw = "", key
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return key
+	}
+
+	key = socketURL(c.socket, u)
+	if method != "" {
+		key = method + " " + key
+	}
+	return key
+}
+
+func (c *responseCache) path(key string) string {
+	h := md5.Sum([]byte(c.key(key)))
+	return filepath.Join(c.dir, hex.EncodeToString(h[:]))
+}
+
+// Get returns the cached response for a key, if present.
+func (c *responseCache) Get(key string) ([]byte, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// responseCacheSizes tracks the total size of each cache directory which has
+// a maximum size, so the directory is only scanned once per run rather than
+// every time a response is stored.
+var responseCacheSizesMu sync.Mutex
+var responseCacheSizes = map[string]int64{}
+
+// Set stores a response for a key. Files are written to a temporary file
+// first and then renamed, so a concurrent reader never sees a partial entry.
+func (c *responseCache) Set(key string, data []byte) {
+	if c.maxSize > 0 && int64(len(data)) > c.maxSize {
+		LogDebug("Not caching %d byte response which exceeds the max cache size", len(data))
+		return
+	}
+
+	path := c.path(key)
+	meta, _ := json.Marshal(responseCacheMeta{Key: c.key(key)})
+
+	var replaced int64
+	if info, err := os.Stat(path); err == nil {
+		replaced = info.Size()
+	}
+
+	err := os.MkdirAll(c.dir, 0700)
+	if err == nil {
+		err = writeFileAtomic(path, data)
+	}
+	if err == nil {
+		err = writeFileAtomic(path+".json", meta)
+	}
+	if err != nil {
+		LogWarning("Unable to cache response: %v", err)
+		return
+	}
+
+	if c.maxSize > 0 {
+		responseCacheSizesMu.Lock()
+		defer responseCacheSizesMu.Unlock()
+
+		size, ok := responseCacheSizes[c.dir]
+		if !ok {
+			size = c.size()
+		} else {
+			size += int64(len(data)) - replaced
+		}
+
+		if size > c.maxSize {
+			size = c.prune()
+		}
+		responseCacheSizes[c.dir] = size
+	}
+}
+
+// Delete removes the cached response for a key.
+func (c *responseCache) Delete(key string) {
+	path := c.path(key)
+
+	if info, err := os.Stat(path); err == nil {
+		responseCacheSizesMu.Lock()
+		if size, ok := responseCacheSizes[c.dir]; ok {
+			responseCacheSizes[c.dir] = size - info.Size()
+		}
+		responseCacheSizesMu.Unlock()
+	}
+
+	os.Remove(path)
+	os.Remove(path + ".json")
+}
+
+// size returns the total size of all entries in the cache.
+func (c *responseCache) size() int64 {
+	entries, _ := listCacheDir(c.dir, "")
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	return total
+}
+
+// prune removes the oldest entries until the cache is below its maximum size
+// and returns the new total size.
+func (c *responseCache) prune() int64 {
+	entries, err := listCacheDir(c.dir, "")
+	if err != nil {
+		return 0
+	}
+
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Stored.Before(entries[j].Stored)
+	})
+
+	for _, e := range entries {
+		if total <= c.maxSize {
+			break
+		}
+		LogDebug("Removing cached response %s to stay below the max cache size", e.path)
+		os.Remove(e.path)
+		os.Remove(e.path + ".json")
+		total -= e.Size
+	}
+
+	return total
+}
+
+// parseSize parses a size in bytes with an optional unit suffix like `KB`,
+// `MB`, or `GB`, which are powers of 1024.
+func parseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "B"), "I")
+
+	multiplier := int64(1)
+	for i, unit := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(s, unit) {
+			multiplier = 1 << (10 * (i + 1))
+			s = strings.TrimSuffix(s, unit)
+			break
+		}
+	}
+
+	size, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	return int64(size * float64(multiplier)), nil
+}
+
+// cachedClient returns a client which caches responses for an API using its
+// cache config. The `--rsh-cache-ttl` flag overrides the configured minimum
+// TTL. If `invalidate` is set, then cached responses are refreshed rather
+// than used. Requests sent over an ad-hoc socket address pass the socket so
+// it is used in the cache key.
+func cachedClient(apiName string, config *CacheConfig, socket string, transport http.RoundTripper, invalidate bool) (*http.Client, error) {
+	if config == nil {
+		config = &CacheConfig{}
+	}
+
+	if config.Disable {
+		return &http.Client{Transport: transport}, nil
+	}
+
+	cache := &responseCache{dir: responseCacheDir(apiName), socket: socket}
+	if config.MaxSize != "" {
+		size, err := parseSize(config.MaxSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache max_size for API %s: %w", apiName, err)
+		}
+		cache.maxSize = size
+	}
+
+	var ttl time.Duration
+	if config.MinTTL != "" {
+		d, err := time.ParseDuration(config.MinTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cache min_ttl for API %s: %w", apiName, err)
+		}
+		ttl = d
+	}
+	if d := viper.GetDuration("rsh-cache-ttl"); d > 0 {
+		ttl = d
+	}
+
+	t := newCachedTransport(cache, transport, ttl)
+
+	if invalidate {
+		return &http.Client{Transport: &invalidateCachedTransport{t}}, nil
+	}
+
+	return t.Client(), nil
+}
+
+// cacheEntry describes a cached response.
+type cacheEntry struct {
+	API     string     `json:"api,omitempty"`
+	Method  string     `json:"method,omitempty"`
+	URL     string     `json:"url,omitempty"`
+	File    string     `json:"file,omitempty"`
+	Status  int        `json:"status,omitempty"`
+	Size    int64      `json:"size"`
+	Stored  time.Time  `json:"stored"`
+	Expires *time.Time `json:"expires,omitempty"`
+	path    string
+}
+
+// listCacheDir returns the cached responses in a directory. Entries stored
+// by older versions have no saved key, so only their filename is known.
+func listCacheDir(dir, apiName string) ([]*cacheEntry, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	entries := []*cacheEntry{}
+	for _, f := range files {
+		// Skip metadata and temporary files which are still being written.
+		if f.IsDir() || strings.HasSuffix(f.Name(), ".json") || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+
+		e := &cacheEntry{
+			API:    apiName,
+			Size:   info.Size(),
+			Stored: info.ModTime(),
+			path:   filepath.Join(dir, f.Name()),
+		}
+
+		meta := responseCacheMeta{}
+		if data, err := os.ReadFile(e.path + ".json"); err == nil && json.Unmarshal(data, &meta) == nil {
+			e.Method = http.MethodGet
+			e.URL = meta.Key
+			if method, u, ok := strings.Cut(meta.Key, " "); ok {
+				e.Method, e.URL = method, u
+			}
+		} else {
+			e.File = f.Name()
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// listCache returns cached responses for an API, or all responses if no API
+// name is given.
+func listCache(apiName string) ([]*cacheEntry, error) {
+	if apiName != "" {
+		return listCacheDir(responseCacheDir(apiName), apiName)
+	}
+
+	entries, err := listCacheDir(responseCacheDir(""), "")
+	if err != nil {
+		return nil, err
+	}
+
+	dirs, _ := os.ReadDir(responseCacheDir(""))
+	for _, d := range dirs {
+		if d.IsDir() {
+			apiEntries, err := listCacheDir(responseCacheDir(d.Name()), d.Name())
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, apiEntries...)
+		}
+	}
+
+	return entries, nil
+}
+
+// readCachedResponse loads a cached response from disk.
+func readCachedResponse(e *cacheEntry) (*http.Response, error) {
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var req *http.Request
+	if e.URL != "" {
+		req, _ = http.NewRequest(e.Method, e.URL, nil)
+	}
+
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+}
+
+// cacheExpires returns when a cached response expires based on its headers,
+// or nil if unknown.
+func cacheExpires(header http.Header) *time.Time {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(directive), "max-age="); ok {
+			date, err := http.ParseTime(header.Get("Date"))
+			seconds, err2 := strconv.Atoi(v)
+			if err == nil && err2 == nil {
+				expires := date.Add(time.Duration(seconds) * time.Second)
+				return &expires
+			}
+		}
+	}
+
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		return &expires
+	}
+
+	return nil
+}
+
+func initCacheCommands() {
+	cacheCommand := &cobra.Command{
+		GroupID: "generic",
+		Use:     "cache",
+		Short:   "Manage the HTTP response cache",
+		Long:    "List, show, and clear cached HTTP responses. The auth token cache is not affected.",
+	}
+	Root.AddCommand(cacheCommand)
+
+	cacheCommand.AddCommand(&cobra.Command{
+		Use:   "list [short-name]",
+		Short: "List cached responses",
+		Long:  "List cached responses as JSON/YAML, optionally only for one API.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			apiName := ""
+			if len(args) > 0 {
+				apiName = args[0]
+			}
+
+			entries, err := listCache(apiName)
+			if err != nil {
+				panic(err)
+			}
+
+			for _, e := range entries {
+				if resp, err := readCachedResponse(e); err == nil {
+					e.Status = resp.StatusCode
+					e.Expires = cacheExpires(resp.Header)
+					resp.Body.Close()
+				}
+			}
+
+			sort.SliceStable(entries, func(i, j int) bool {
+				if entries[i].API != entries[j].API {
+					return entries[i].API < entries[j].API
+				}
+				return entries[i].URL < entries[j].URL
+			})
+
+			printStructured(entries)
+		},
+	})
+
+	cacheCommand.AddCommand(&cobra.Command{
+		Use:   "show uri",
+		Short: "Show a cached response",
+		Long:  "Show the cached response for a GET request to a URI without making a request.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			uri := fixAddress(args[0])
+
+			entries, err := listCache("")
+			if err != nil {
+				panic(err)
+			}
+
+			for _, e := range entries {
+				if e.Method != http.MethodGet || e.URL != uri {
+					continue
+				}
+
+				resp, err := readCachedResponse(e)
+				if err != nil {
+					panic(err)
+				}
+
+				parsed, err := ParseResponse(resp)
+				if err != nil {
+					panic(err)
+				}
+
+				if err := Formatter.Format(parsed); err != nil {
+					panic(err)
+				}
+				return
+			}
+
+			panic("no cached response for " + uri)
+		},
+	})
+
+	cacheCommand.AddCommand(&cobra.Command{
+		Use:   "clear [short-name]",
+		Short: "Clear cached responses",
+		Long:  "Remove all cached responses, or only those for one API.",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			apiName := ""
+			if len(args) > 0 {
+				apiName = args[0]
+				if configs[apiName] == nil {
+					panic("API " + apiName + " not found")
+				}
+			}
+
+			if err := os.RemoveAll(responseCacheDir(apiName)); err != nil {
+				panic(fmt.Errorf("Unable to clear cache: %w", err))
+			}
+
+			responseCacheSizesMu.Lock()
+			responseCacheSizes = map[string]int64{}
+			responseCacheSizesMu.Unlock()
+		},
+	})
+
+	cacheCommand.AddCommand(&cobra.Command{
+		Use:   "stats",
+		Short: "Show cache statistics",
+		Long:  "Show the number and total size in bytes of cached responses, both overall and for each API.",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			entries, err := listCache("")
+			if err != nil {
+				panic(err)
+			}
+
+			type apiStats struct {
+				API     string `json:"api,omitempty"`
+				Entries int    `json:"entries"`
+				Size    int64  `json:"size"`
+				MaxSize int64  `json:"max_size,omitempty"`
+			}
+
+			stats := struct {
+				Entries int         `json:"entries"`
+				Size    int64       `json:"size"`
+				APIs    []*apiStats `json:"apis"`
+			}{APIs: []*apiStats{}}
+
+			byAPI := map[string]*apiStats{}
+			for _, e := range entries {
+				s := byAPI[e.API]
+				if s == nil {
+					s = &apiStats{API: e.API}
+					if c := configs[e.API]; c != nil && c.Cache != nil && c.Cache.MaxSize != "" {
+						s.MaxSize, _ = parseSize(c.Cache.MaxSize)
+					}
+					byAPI[e.API] = s
+					stats.APIs = append(stats.APIs, s)
+				}
+				s.Entries++
+				s.Size += e.Size
+				stats.Entries++
+				stats.Size += e.Size
+			}
+
+			sort.Slice(stats.APIs, func(i, j int) bool {
+				return stats.APIs[i].API < stats.APIs[j].API
+			})
+
+			printStructured(stats)
+		},
+	})
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestParseSize(t *testing.T) {
+	for input, expected := range map[string]int64{
+		"100":    100,
+		"2KB":    2048,
+		"1.5 MB": 1536 * 1024,
+		"1GiB":   1 << 30,
+		"3k":     3072,
+	} {
+		size, err := parseSize(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, size, input)
+	}
+
+	_, err := parseSize("lots")
+	assert.Error(t, err)
+}
+
+func TestResponseCacheMaxSize(t *testing.T) {
+	c := &responseCache{dir: t.TempDir(), maxSize: 25}
+
+	c.Set("http://example.com/a", []byte("0123456789"))
+	os.Chtimes(c.path("http://example.com/a"), time.Now(), time.Now().Add(-time.Minute))
+	c.Set("http://example.com/b", []byte("0123456789"))
+	c.Set("http://example.com/c", []byte("0123456789"))
+
+	// The oldest entry is removed to make room for the newest.
+	_, ok := c.Get("http://example.com/a")
+	assert.False(t, ok)
+	_, ok = c.Get("http://example.com/b")
+	assert.True(t, ok)
+	_, ok = c.Get("http://example.com/c")
+	assert.True(t, ok)
+
+	// The size is tracked as entries are stored and replaced, and no temporary
+	// files are left behind.
+	c.Set("http://example.com/c", []byte("01234"))
+	assert.Equal(t, int64(15), responseCacheSizes[c.dir])
+	c.Delete("http://example.com/b")
+	assert.Equal(t, int64(5), responseCacheSizes[c.dir])
+	files, _ := os.ReadDir(c.dir)
+	assert.Len(t, files, 2)
+
+	// Responses bigger than the whole cache are never stored.
+	c.Set("http://example.com/d", make([]byte, 100))
+	_, ok = c.Get("http://example.com/d")
+	assert.False(t, ok)
+}
+
+func TestCacheCommands(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	viper.Set("cache-dir", t.TempDir())
+	configs["cache-test"] = &APIConfig{
+		name:  "cache-test",
+		Base:  "http://cache.example.com",
+		Cache: &CacheConfig{MinTTL: "1h"},
+	}
+	defer delete(configs, "cache-test")
+
+	// Only one response is mocked, so the second request must be cached.
+	gock.New("http://cache.example.com").
+		Get("/items").
+		Reply(http.StatusOK).
+		SetHeader("Date", time.Now().UTC().Format(http.TimeFormat)).
+		JSON(map[string]any{"hello": "world"})
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://cache.example.com/items", nil)
+		resp, err := MakeRequest(req)
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		parsed, err := ParseResponse(resp)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]any{"hello": "world"}, parsed.Body)
+	}
+
+	entries := []map[string]any{}
+	assert.NoError(t, json.Unmarshal([]byte(runNoReset("cache list")), &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "cache-test", entries[0]["api"])
+	assert.Equal(t, "http://cache.example.com/items", entries[0]["url"])
+	assert.EqualValues(t, http.StatusOK, entries[0]["status"])
+	assert.NotEmpty(t, entries[0]["expires"])
+
+	captured := runNoReset("cache show http://cache.example.com/items")
+	assert.Contains(t, captured, "world")
+
+	stats := map[string]any{}
+	assert.NoError(t, json.Unmarshal([]byte(runNoReset("cache stats")), &stats))
+	assert.EqualValues(t, 1, stats["entries"])
+
+	runNoReset("cache clear cache-test")
+	entries = []map[string]any{}
+	assert.NoError(t, json.Unmarshal([]byte(runNoReset("cache list")), &entries))
+	assert.Empty(t, entries)
+}
+
+func TestCacheDisabled(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	viper.Set("cache-dir", t.TempDir())
+	configs["no-cache-test"] = &APIConfig{
+		name:  "no-cache-test",
+		Base:  "http://no-cache.example.com",
+		Cache: &CacheConfig{Disable: true},
+	}
+	defer delete(configs, "no-cache-test")
+
+	gock.New("http://no-cache.example.com").
+		Get("/items").
+		Times(2).
+		Reply(http.StatusOK).
+		SetHeader("Date", time.Now().UTC().Format(http.TimeFormat)).
+		SetHeader("Cache-Control", "max-age=3600").
+		JSON(map[string]any{"hello": "world"})
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, "http://no-cache.example.com/items", nil)
+		resp, err := MakeRequest(req)
+		assert.NoError(t, err)
+		ParseResponse(resp)
+	}
+
+	assert.True(t, gock.IsDone())
+
+	entries, err := listCache("")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestCachedTransportEntries(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	viper.Set("cache-dir", t.TempDir())
+
+	gock.New("http://exported.example.com").
+		Get("/items").
+		Reply(http.StatusOK).
+		JSON(map[string]any{"hello": "world"})
+
+	// The exported transports share the same cache layout, so their entries
+	// can be listed by the cache commands.
+	req, _ := http.NewRequest(http.MethodGet, "http://exported.example.com/items", nil)
+	resp, err := MinCachedTransport(time.Hour).RoundTrip(req)
+	assert.NoError(t, err)
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	entries := []map[string]any{}
+	assert.NoError(t, json.Unmarshal([]byte(runNoReset("cache list")), &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "http://exported.example.com/items", entries[0]["url"])
+	assert.EqualValues(t, 200, entries[0]["status"])
+}
@@ -0,0 +1,380 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/spf13/viper"
+)
+
+// cassetteInteraction is a single recorded request/response exchange.
+type cassetteInteraction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+type cassetteRequest struct {
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Headers  http.Header `json:"headers,omitempty"`
+	BodyHash string      `json:"body_hash,omitempty"`
+}
+
+type cassetteResponse struct {
+	Proto        string      `json:"proto"`
+	Status       int         `json:"status"`
+	Headers      http.Header `json:"headers,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// cassette stores recorded interactions in a directory, one file per unique
+// request. Repeated identical requests are stored in order and replayed in the
+// same order, with the last one repeating once all have been used.
+type cassette struct {
+	mu           sync.Mutex
+	dir          string
+	matchHeaders []string
+}
+
+// cassetteSession tracks how many interactions have been recorded or replayed
+// for each key. It is stored in the cassette directory so that a script which
+// runs Restish many times shares one session across all of those processes.
+type cassetteSession struct {
+	ID     string         `json:"id"`
+	Mode   string         `json:"mode"`
+	Counts map[string]int `json:"counts"`
+}
+
+const cassetteSessionFile = ".session.json"
+
+var cassettesMu sync.Mutex
+var cassettes = map[string]*cassette{}
+
+// getCassette returns the cassette for a directory, creating it as needed so
+// that all requests in a single run share a lock on the session state.
+func getCassette(dir string, matchHeaders []string) *cassette {
+	cassettesMu.Lock()
+	defer cassettesMu.Unlock()
+
+	c := cassettes[dir]
+	if c == nil {
+		c = &cassette{dir: dir}
+		cassettes[dir] = c
+	}
+	c.matchHeaders = matchHeaders
+
+	return c
+}
+
+// cassetteProcessSession is the session used when none is set explicitly, so
+// that each run of Restish starts a new session.
+var cassetteProcessSession = newCassetteSessionID()
+
+// newCassetteSessionID returns a new random session ID.
+func newCassetteSessionID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// cassetteSessionID identifies the current session. By default every process
+// is a new session, which can be shared between commands, e.g. all the
+// commands in a script, by setting it explicitly.
+func cassetteSessionID() string {
+	if id := viper.GetString("rsh-cassette-session"); id != "" {
+		return id
+	}
+	return cassetteProcessSession
+}
+
+// session loads the session state for a mode, starting a new one if the
+// stored state belongs to a different session or mode.
+func (c *cassette) session(mode string) *cassetteSession {
+	s := &cassetteSession{}
+	if data, err := os.ReadFile(filepath.Join(c.dir, cassetteSessionFile)); err == nil {
+		json.Unmarshal(data, s)
+	}
+
+	id := cassetteSessionID()
+	if s.ID != id || s.Mode != mode || s.Counts == nil {
+		s = &cassetteSession{ID: id, Mode: mode, Counts: map[string]int{}}
+	}
+
+	return s
+}
+
+// saveSession writes the session state back to the cassette directory.
+func (c *cassette) saveSession(s *cassetteSession) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(c.dir, cassetteSessionFile), data)
+}
+
+// writeFileAtomic writes to a temporary file and renames it into place so
+// that readers never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+var cassetteUnsafeChars = regexp.MustCompile(`[^a-zA-Z0-9.]+`)
+
+// key returns the filename used to store interactions for a request. It is
+// built from the method, URL, body hash, and any configured headers to match.
+func (c *cassette) key(req *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", req.Method, req.URL.String())
+
+	headers := append([]string{}, c.matchHeaders...)
+	sort.Strings(headers)
+	for _, name := range headers {
+		fmt.Fprintf(h, "%s: %s\n", http.CanonicalHeaderKey(name), strings.Join(req.Header.Values(name), ", "))
+	}
+
+	if len(body) > 0 {
+		fmt.Fprintf(h, "%x\n", sha256.Sum256(body))
+	}
+
+	// Include a readable prefix to make it easier to find a specific request.
+	prefix := cassetteUnsafeChars.ReplaceAllString(req.Method+" "+req.URL.Host+req.URL.Path, "-")
+	if len(prefix) > 64 {
+		prefix = prefix[:64]
+	}
+
+	return strings.Trim(prefix, "-") + "-" + hex.EncodeToString(h.Sum(nil))[:16] + ".json"
+}
+
+// load the recorded interactions for a key.
+func (c *cassette) load(key string) ([]cassetteInteraction, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, key))
+	if err != nil {
+		return nil, err
+	}
+
+	var interactions []cassetteInteraction
+	if err := json.Unmarshal(data, &interactions); err != nil {
+		return nil, fmt.Errorf("invalid cassette file %s: %w", key, err)
+	}
+
+	return interactions, nil
+}
+
+// save an interaction for a key. The first interaction recorded for a key in
+// a session replaces any interactions recorded for it by previous sessions.
+func (c *cassette) save(key string, interaction cassetteInteraction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+
+	s := c.session("record")
+
+	var interactions []cassetteInteraction
+	if s.Counts[key] > 0 {
+		interactions, _ = c.load(key)
+	}
+	interactions = append(interactions, interaction)
+
+	data, err := json.MarshalIndent(interactions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(filepath.Join(c.dir, key), data); err != nil {
+		return err
+	}
+
+	s.Counts[key] = len(interactions)
+	return c.saveSession(s)
+}
+
+// next returns the next interaction to replay for a key.
+func (c *cassette) next(key string) (*cassetteInteraction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	interactions, err := c.load(key)
+	if err != nil || len(interactions) == 0 {
+		return nil, err
+	}
+
+	s := c.session("replay")
+	i := min(s.Counts[key], len(interactions)-1)
+	s.Counts[key]++
+
+	if err := c.saveSession(s); err != nil {
+		LogWarning("Unable to save cassette session: %v", err)
+	}
+
+	return &interactions[i], nil
+}
+
+// readBody reads and replaces a request body so it can be hashed.
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	return body, err
+}
+
+// redactCassetteHeaders returns a copy of the headers with secrets like auth
+// headers and cookies redacted.
+func redactCassetteHeaders(header http.Header) http.Header {
+	headers := header.Clone()
+	for name := range headers {
+		if harSensitiveHeaders[name] {
+			headers.Set(name, harRedacted)
+		}
+	}
+	return headers
+}
+
+// recordTransport saves each exchange to a cassette.
+type recordTransport struct {
+	cassette  *cassette
+	transport http.RoundTripper
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Secrets are not needed to replay, so don't store them.
+	interaction := cassetteInteraction{
+		Request: cassetteRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Headers: redactCassetteHeaders(req.Header),
+		},
+		Response: cassetteResponse{
+			Proto:   resp.Proto,
+			Status:  resp.StatusCode,
+			Headers: redactCassetteHeaders(resp.Header),
+		},
+	}
+
+	if len(body) > 0 {
+		interaction.Request.BodyHash = fmt.Sprintf("%x", sha256.Sum256(body))
+	}
+
+	key := t.cassette.key(req, body)
+
+	// Save once the body has been read so that streaming responses are passed
+	// through as they arrive rather than buffered up front.
+	resp.Body = &captureBody{
+		ReadCloser: resp.Body,
+		done: func(respBody []byte) {
+			t.save(key, interaction, respBody)
+		},
+	}
+
+	return resp, nil
+}
+
+// save an interaction with its response body to the cassette.
+func (t *recordTransport) save(key string, interaction cassetteInteraction, respBody []byte) {
+	if utf8.Valid(respBody) {
+		interaction.Response.Body = string(respBody)
+	} else {
+		interaction.Response.Body = base64.StdEncoding.EncodeToString(respBody)
+		interaction.Response.BodyEncoding = "base64"
+	}
+
+	LogDebug("Recording %s %s to %s", interaction.Request.Method, interaction.Request.URL, key)
+	if err := t.cassette.save(key, interaction); err != nil {
+		LogWarning("Unable to record response: %v", err)
+	}
+}
+
+// replayTransport serves previously recorded exchanges from a cassette and
+// never touches the network.
+type replayTransport struct {
+	cassette *cassette
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	key := t.cassette.key(req, body)
+	interaction, err := t.cassette.next(key)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if interaction == nil {
+		return nil, fmt.Errorf("no recorded response for %s %s in %s (expected %s)", req.Method, req.URL, t.cassette.dir, key)
+	}
+	LogDebug("Replaying %s %s from %s", req.Method, req.URL, key)
+
+	r := interaction.Response
+	respBody := []byte(r.Body)
+	if r.BodyEncoding == "base64" {
+		if respBody, err = base64.StdEncoding.DecodeString(r.Body); err != nil {
+			return nil, fmt.Errorf("invalid cassette file %s: %w", key, err)
+		}
+	}
+
+	resp := &http.Response{
+		Proto:         r.Proto,
+		StatusCode:    r.Status,
+		Status:        fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status)),
+		Header:        r.Headers,
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}
+	resp.ProtoMajor, resp.ProtoMinor, _ = http.ParseHTTPVersion(r.Proto)
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+
+	return resp, nil
+}
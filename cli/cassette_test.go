@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	defer gock.Off()
+	dir := t.TempDir()
+	t.Setenv("RSH_CASSETTE_SESSION", "record")
+
+	gock.New("http://example.com").
+		Get("/items").
+		Reply(http.StatusOK).
+		JSON([]any{map[string]any{"id": 1}})
+
+	gock.New("http://example.com").
+		Get("/items").
+		Reply(http.StatusOK).
+		JSON([]any{map[string]any{"id": 2}})
+
+	// Each command runs with fresh in-memory state, like separate processes
+	// started by a script.
+	fresh := func(args string) string {
+		cassettes = map[string]*cassette{}
+		return run(args)
+	}
+
+	captured := fresh("--rsh-record " + dir + " -f body[0].id http://example.com/items")
+	assert.Equal(t, "1\n", captured)
+	captured = fresh("--rsh-record " + dir + " -f body[0].id http://example.com/items")
+	assert.Equal(t, "2\n", captured)
+
+	files, _ := filepath.Glob(filepath.Join(dir, "GET-*.json"))
+	assert.Len(t, files, 1)
+
+	// Replay must not use the network, so remove all mocks.
+	gock.Flush()
+	t.Setenv("RSH_CASSETTE_SESSION", "replay")
+
+	captured = fresh("--rsh-replay " + dir + " -f body[0].id http://example.com/items")
+	assert.Equal(t, "1\n", captured)
+	captured = fresh("--rsh-replay " + dir + " -f body[0].id http://example.com/items")
+	assert.Equal(t, "2\n", captured)
+
+	// Once all recorded responses are used, the last one repeats.
+	captured = fresh("--rsh-replay " + dir + " -f body[0].id http://example.com/items")
+	assert.Equal(t, "2\n", captured)
+
+	// A new session starts replaying from the beginning again.
+	t.Setenv("RSH_CASSETTE_SESSION", "replay-again")
+	captured = fresh("--rsh-replay " + dir + " -f body[0].id http://example.com/items")
+	assert.Equal(t, "1\n", captured)
+
+	// A new recording session replaces the previously recorded responses.
+	gock.New("http://example.com").
+		Get("/items").
+		Reply(http.StatusOK).
+		JSON([]any{map[string]any{"id": 3}})
+
+	t.Setenv("RSH_CASSETTE_SESSION", "record-again")
+	fresh("--rsh-record " + dir + " -f body[0].id http://example.com/items")
+
+	gock.Flush()
+	t.Setenv("RSH_CASSETTE_SESSION", "replay-new")
+	captured = fresh("--rsh-replay " + dir + " -f body[0].id http://example.com/items")
+	assert.Equal(t, "3\n", captured)
+	captured = fresh("--rsh-replay " + dir + " -f body[0].id http://example.com/items")
+	assert.Equal(t, "3\n", captured)
+}
+
+func TestCassetteDefaultSession(t *testing.T) {
+	defer gock.Off()
+	dir := t.TempDir()
+	t.Setenv("RSH_CASSETTE_SESSION", "")
+	defer func(orig string) { cassetteProcessSession = orig }(cassetteProcessSession)
+
+	gock.New("http://example.com").
+		Get("/items").
+		Times(3).
+		Reply(http.StatusOK).
+		SetHeader("Set-Cookie", "session=abc123").
+		JSON([]any{})
+
+	record := func() []cassetteInteraction {
+		cassettes = map[string]*cassette{}
+		run("--rsh-record " + dir + " http://example.com/items")
+
+		files, _ := filepath.Glob(filepath.Join(dir, "GET-*.json"))
+		require.Len(t, files, 1)
+		data, err := os.ReadFile(files[0])
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "abc123")
+
+		var interactions []cassetteInteraction
+		require.NoError(t, json.Unmarshal(data, &interactions))
+		return interactions
+	}
+
+	// Commands in the same process share a session.
+	cassetteProcessSession = "first"
+	record()
+	interactions := record()
+	assert.Len(t, interactions, 2)
+	assert.Equal(t, harRedacted, interactions[0].Response.Headers.Get("Set-Cookie"))
+
+	// Each new process starts a new session, replacing the recorded responses.
+	cassetteProcessSession = "second"
+	assert.Len(t, record(), 1)
+}
+
+func TestCassetteRecordStream(t *testing.T) {
+	gock.Off()
+	dir := t.TempDir()
+	t.Setenv("RSH_CASSETTE_SESSION", "stream")
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("data: 2\n\n"))
+	}))
+	defer server.Close()
+
+	c := &cassette{dir: dir}
+	transport := &recordTransport{cassette: c, transport: http.DefaultTransport}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+
+	// The first event is available before the stream has finished.
+	buf := make([]byte, 9)
+	_, err = io.ReadFull(resp.Body, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "data: 1\n\n", string(buf))
+
+	close(release)
+	rest, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "data: 2\n\n", string(rest))
+	resp.Body.Close()
+
+	interaction, err := c.next(c.key(req, nil))
+	require.NoError(t, err)
+	assert.Equal(t, "data: 1\n\ndata: 2\n\n", interaction.Response.Body)
+}
+
+func TestCassetteMatching(t *testing.T) {
+	defer gock.Off()
+	dir := t.TempDir()
+
+	reset(false)
+	viper.Set("rsh-record", dir)
+	viper.Set("rsh-match-header", []string{"X-Tenant"})
+
+	gock.New("http://example.com").
+		Post("/items").
+		BodyString("one").
+		Reply(http.StatusCreated).
+		BodyString("created one")
+
+	gock.New("http://example.com").
+		Post("/items").
+		BodyString("two").
+		Reply(http.StatusCreated).
+		BodyString("created two")
+
+	gock.New("http://example.com").
+		Post("/items").
+		BodyString("two").
+		Reply(http.StatusConflict).
+		BodyString("other tenant")
+
+	makeRequest := func(body, tenant string) (Response, error) {
+		req, _ := http.NewRequest(http.MethodPost, "http://example.com/items", bytes.NewReader([]byte(body)))
+		req.Header.Set("X-Tenant", tenant)
+		return GetParsedResponse(req)
+	}
+
+	_, err := makeRequest("one", "a")
+	assert.NoError(t, err)
+	_, err = makeRequest("two", "a")
+	assert.NoError(t, err)
+	_, err = makeRequest("two", "b")
+	assert.NoError(t, err)
+
+	gock.Flush()
+	reset(false)
+	viper.Set("rsh-replay", dir)
+	viper.Set("rsh-match-header", []string{"X-Tenant"})
+
+	resp, err := makeRequest("two", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, resp.Status)
+	assert.Equal(t, []byte("other tenant"), resp.Body)
+
+	resp, err = makeRequest("one", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.Status)
+	assert.Equal(t, []byte("created one"), resp.Body)
+
+	_, err = makeRequest("three", "a")
+	assert.ErrorContains(t, err, "no recorded response")
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,7 +12,9 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime/debug"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/glamour"
@@ -33,9 +36,20 @@ var Root *cobra.Command
 // to cobra
 var GlobalFlags *pflag.FlagSet
 
-// Cache is used to store temporary data between runs.
+// Cache is used to store temporary data between runs. Use `LockCache` when
+// it may be used by concurrent requests, e.g. to store auth tokens.
 var Cache *viper.Viper
 
+// cacheMu guards the `Cache` from concurrent use.
+var cacheMu sync.Mutex
+
+// LockCache locks the cache for exclusive use, e.g. while reading and updating
+// a cached auth token, and returns a function to unlock it.
+func LockCache() (unlock func()) {
+	cacheMu.Lock()
+	return cacheMu.Unlock
+}
+
 // Formatter is the currently configured response output formatter.
 var Formatter ResponseFormatter
 
@@ -54,17 +68,15 @@ var au aurora.Aurora
 var currentConfig *APIConfig
 
 func generic(method string, addr string, args []string) {
-	var body io.Reader
-
-	d, err := GetBody("application/json", args)
+	// Bodies are JSON unless another content type is passed, e.g. via
+	// `-H Content-Type:application/cbor`.
+	body, contentType, err := GetBodyReader(bodyMediaType("application/json"), args)
 	if err != nil {
 		panic(err)
 	}
-	if len(d) > 0 {
-		body = strings.NewReader(d)
-	}
 
 	req, _ := http.NewRequest(method, fixAddress(addr), body)
+	setBodyContentType(req, body, contentType)
 	MakeRequestAndFormat(req)
 }
 
@@ -190,7 +202,7 @@ func Init(name string, version string) {
 	// Reset registries.
 	authHandlers = map[string]AuthHandler{}
 	contentTypes = map[string]contentTypeEntry{}
-	encodings = map[string]ContentEncoding{}
+	encodings = map[string]encodingEntry{}
 	linkParsers = []LinkParser{}
 	loaders = []Loader{}
 
@@ -528,6 +540,74 @@ Not after (expires): %s (%s)
 	}
 	Root.AddCommand(linkCmd)
 
+	download := &cobra.Command{
+		GroupID:           "generic",
+		Use:               "download uri [file]",
+		Short:             "Download a URI to a file",
+		Long:              "Perform an HTTP GET on the given URI and stream the response body to a file, showing progress. Without a file, the current directory is used with the filename from the server or the URI. Interrupted downloads are resumed.",
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: completeGenericCmd(http.MethodGet, true),
+		Run: func(cmd *cobra.Command, args []string) {
+			output := viper.GetString("rsh-output-file")
+			if len(args) > 1 {
+				output = args[1]
+			}
+			if output == "" {
+				output = "."
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, fixAddress(args[0]), nil)
+			MakeRequestAndDownload(req, output)
+		},
+	}
+	Root.AddCommand(download)
+
+	var curlPrint *bool
+	fromCurlCmd := &cobra.Command{
+		GroupID: "generic",
+		Use:     "from-curl [curl-command]",
+		Short:   "Convert or run a curl command",
+		Long:    "Parse a curl command and make the same request, or print the equivalent restish command with `--rsh-print`. Pass the command as a single quoted argument, after `--`, or via stdin. JSON and form data is converted to shorthand.",
+		Example: fmt.Sprintf("  %s from-curl 'curl -X POST https://api.rest.sh/ -H \"Content-Type: application/json\" -d \"{\\\"id\\\": 1}\"'\n  %s from-curl --rsh-print -- curl -k https://localhost:8443/items", Root.CommandPath(), Root.CommandPath()),
+		Run: func(cmd *cobra.Command, args []string) {
+			fromCurl(args, *curlPrint)
+		},
+	}
+	curlPrint = fromCurlCmd.Flags().Bool("rsh-print", false, "Print the equivalent restish command instead of making the request")
+	Root.AddCommand(fromCurlCmd)
+
+	var batchConcurrency *int
+	var batchFailFast *bool
+	batchCmd := &cobra.Command{
+		GroupID: "generic",
+		Use:     "batch file",
+		Short:   "Make many requests concurrently",
+		Long:    "Read request specs from a JSON lines file, or stdin if the file is `-`, and make the requests concurrently. Each spec has a `uri` plus an optional `method`, `headers`, `body`, and `name`. The result of each request is written as a JSON line as soon as it completes, and the exit code reflects any failures.",
+		Example: fmt.Sprintf("  %s batch requests.jsonl\n  %s batch --rsh-concurrency 10 --rsh-fail-fast - <requests.jsonl", Root.CommandPath(), Root.CommandPath()),
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			batch(args[0], *batchConcurrency, *batchFailFast)
+		},
+	}
+	batchConcurrency = batchCmd.Flags().Int("rsh-concurrency", 4, "Maximum number of requests to make at once")
+	batchFailFast = batchCmd.Flags().Bool("rsh-fail-fast", false, "Stop after the first failed request")
+	Root.AddCommand(batchCmd)
+
+	var workflowReport *string
+	runCmd := &cobra.Command{
+		GroupID: "generic",
+		Use:     "run file",
+		Short:   "Run a workflow of requests",
+		Long:    "Run the steps of a YAML or JSON workflow file, or stdin if the file is `-`, in order. Each step makes a request and can extract values from the response for use in later steps as `${name}`, and check expectations using mexpr expressions. Results are reported as text or JUnit XML, and the command fails if any step does not pass.",
+		Example: fmt.Sprintf("  %s run flow.yaml\n  %s run --rsh-report junit flow.yaml >report.xml", Root.CommandPath(), Root.CommandPath()),
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			runWorkflowFile(args[0], *workflowReport)
+		},
+	}
+	workflowReport = runCmd.Flags().String("rsh-report", "text", "Report format [text, junit]")
+	Root.AddCommand(runCmd)
+
 	GlobalFlags = pflag.NewFlagSet("eager-flags", pflag.ContinueOnError)
 	GlobalFlags.ParseErrorsWhitelist.UnknownFlags = true
 	// GlobalFlags are 'hidden', don't print anything on error
@@ -544,20 +624,57 @@ Not after (expires): %s (%s)
 	AddGlobalFlag("rsh-header", "H", "Add custom header", []string{}, true)
 	AddGlobalFlag("rsh-query", "q", "Add custom query param", []string{}, true)
 	AddGlobalFlag("rsh-no-paginate", "", "Disable auto-pagination", false, false)
+	AddGlobalFlag("rsh-max-pages", "", "Maximum number of pages to fetch when auto-paginating (0 for no limit)", 0, false)
+	AddGlobalFlag("rsh-max-items", "", "Maximum number of items to return when auto-paginating (0 for no limit)", 0, false)
+	AddGlobalFlag("rsh-stream", "", "Print the items of each page as it arrives when auto-paginating", false, false)
 	AddGlobalFlag("rsh-profile", "p", "API auth profile", "default", false)
 	AddGlobalFlag("rsh-no-cache", "", "Disable HTTP cache", false, false)
+	AddGlobalFlag("rsh-cache-ttl", "", "Minimum time to cache responses without cache headers", time.Duration(0), false)
 	AddGlobalFlag("rsh-insecure", "", "Disable SSL verification", false, false)
 	AddGlobalFlag("rsh-client-cert", "", "Path to a PEM encoded client certificate", "", false)
 	AddGlobalFlag("rsh-client-key", "", "Path to a PEM encoded private key", "", false)
 	AddGlobalFlag("rsh-ca-cert", "", "Path to a PEM encoded CA cert", "", false)
+	AddGlobalFlag("rsh-proxy", "", "Proxy URL (http, https, socks5) or 'direct' to disable proxying", "", false)
 	AddGlobalFlag("rsh-ignore-status-code", "", "Do not set exit code from HTTP status code", false, false)
+	AddGlobalFlag("rsh-expect", "", "Expression which must be true for the response, can be passed multiple times", []string{}, true)
 	AddGlobalFlag("rsh-retry", "", "Number of times to retry on certain failures", 2, false)
+	AddGlobalFlag("rsh-retry-backoff", "", "Initial delay between retries, doubled after each retry", 1*time.Second, false)
+	AddGlobalFlag("rsh-retry-max-delay", "", "Maximum delay between retries", 30*time.Second, false)
+	AddGlobalFlag("rsh-retry-status", "", "Response status code to retry (replaces the defaults)", []string{}, true)
+	AddGlobalFlag("rsh-retry-all-methods", "", "Retry non-idempotent methods like POST without an Idempotency-Key header", false, false)
 	AddGlobalFlag("rsh-timeout", "t", "Timeout for HTTP requests", time.Duration(0), false)
+	AddGlobalFlag("rsh-compress-body", "", "Compress request bodies with a content encoding [gzip, br, zstd, ...]", "", false)
+	AddGlobalFlag("rsh-timing", "", "Show request timing breakdown", false, false)
+	AddGlobalFlag("rsh-dry-run", "", "Show the request that would be made without sending it", false, false)
+	AddGlobalFlag("rsh-dry-run-unsafe", "", "Do not redact auth and cookie values in dry run output", false, false)
+	AddGlobalFlag("rsh-export", "", "Print an equivalent command or code instead of sending the request [curl, httpie, go, python-requests]", "", false)
+	AddGlobalFlag("rsh-output-file", "O", "Stream the response body to a file, or a directory to use the server's filename", "", false)
+	AddGlobalFlag("rsh-har", "", "Record all requests and responses to a HAR file", "", false)
+	AddGlobalFlag("rsh-har-unsafe", "", "Do not redact auth and cookie values in the HAR file", false, false)
+	AddGlobalFlag("rsh-record", "", "Record all requests and responses to a cassette directory", "", false)
+	AddGlobalFlag("rsh-replay", "", "Replay responses from a cassette directory without using the network", "", false)
+	AddGlobalFlag("rsh-match-header", "", "Header name to match when recording & replaying", []string{}, true)
+	AddGlobalFlag("rsh-cassette-session", "", "Session to share cassette progress between commands, e.g. in a script", "", false)
 
 	Root.RegisterFlagCompletionFunc("rsh-output-format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		return []string{"auto", "json", "yaml"}, cobra.ShellCompDirectiveNoFileComp
 	})
 
+	Root.RegisterFlagCompletionFunc("rsh-compress-body", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		names := []string{}
+		for name, entry := range encodings {
+			if _, ok := entry.encoding.(ContentEncoder); ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		return names, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	Root.RegisterFlagCompletionFunc("rsh-export", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return exportFormatNames(), cobra.ShellCompDirectiveNoFileComp
+	})
+
 	Root.RegisterFlagCompletionFunc("rsh-profile", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		profiles := []string{}
 		if currentConfig != nil {
@@ -569,6 +686,7 @@ Not after (expires): %s (%s)
 	})
 
 	initAPIConfig()
+	initCacheCommands()
 }
 
 func userHomeDir() string {
@@ -691,15 +809,17 @@ func initCache(appName string) {
 // the CLI.
 func Defaults() {
 	// Register content encodings
-	AddEncoding("deflate", &DeflateEncoding{})
-	AddEncoding("gzip", &GzipEncoding{})
-	AddEncoding("br", &BrotliEncoding{})
+	AddEncodingWithQ("zstd", 1.0, &ZstdEncoding{})
+	AddEncodingWithQ("br", 0.9, &BrotliEncoding{})
+	AddEncodingWithQ("gzip", 0.8, &GzipEncoding{})
+	AddEncodingWithQ("deflate", 0.5, &DeflateEncoding{})
 
 	// Register content type marshallers
 	AddContentType("cbor", "application/cbor", 0.9, &CBOR{})
 	AddContentType("msgpack", "application/msgpack", 0.8, &MsgPack{})
 	AddContentType("ion", "application/ion", 0.6, &Ion{})
 	AddContentType("json", "application/json", 0.5, &JSON{})
+	AddContentType("jsonl", "application/x-ndjson", 0.4, &NDJSON{})
 	AddContentType("yaml", "application/yaml", 0.5, &YAML{})
 	AddContentType("text", "text/*", 0.2, &Text{})
 	AddContentType("table", "", -1, &Table{})
@@ -764,6 +884,9 @@ func Run() (returnErr error) {
 	if caCert, _ := GlobalFlags.GetString("rsh-ca-cert"); caCert != "" {
 		viper.Set("rsh-ca-cert", caCert)
 	}
+	if proxy, _ := GlobalFlags.GetString("rsh-proxy"); proxy != "" {
+		viper.Set("rsh-proxy", proxy)
+	}
 	if query, _ := GlobalFlags.GetStringArray("rsh-query"); len(query) > 0 {
 		viper.Set("rsh-query", query)
 	}
@@ -772,12 +895,43 @@ func Run() (returnErr error) {
 	}
 	profile, _ := GlobalFlags.GetString("rsh-profile")
 	viper.Set("rsh-profile", profile)
-	if retries, _ := GlobalFlags.GetInt("rsh-retry"); retries > 0 {
+	if retries, _ := GlobalFlags.GetInt("rsh-retry"); retries > 0 || GlobalFlags.Changed("rsh-retry") {
+		// Explicitly passing `--rsh-retry=0` disables retries.
 		viper.Set("rsh-retry", retries)
 	}
+	if backoff, _ := GlobalFlags.GetDuration("rsh-retry-backoff"); GlobalFlags.Changed("rsh-retry-backoff") {
+		viper.Set("rsh-retry-backoff", backoff)
+	}
+	if maxDelay, _ := GlobalFlags.GetDuration("rsh-retry-max-delay"); GlobalFlags.Changed("rsh-retry-max-delay") {
+		viper.Set("rsh-retry-max-delay", maxDelay)
+	}
+	if codes, _ := GlobalFlags.GetStringArray("rsh-retry-status"); len(codes) > 0 {
+		viper.Set("rsh-retry-status", codes)
+	}
+	if allMethods, _ := GlobalFlags.GetBool("rsh-retry-all-methods"); allMethods {
+		viper.Set("rsh-retry-all-methods", true)
+	}
 	if timeout, _ := GlobalFlags.GetDuration("rsh-timeout"); timeout > 0 {
 		viper.Set("rsh-timeout", timeout)
 	}
+	if har, _ := GlobalFlags.GetString("rsh-har"); har != "" {
+		viper.Set("rsh-har", har)
+	}
+	if unsafe, _ := GlobalFlags.GetBool("rsh-har-unsafe"); unsafe {
+		viper.Set("rsh-har-unsafe", true)
+	}
+	if record, _ := GlobalFlags.GetString("rsh-record"); record != "" {
+		viper.Set("rsh-record", record)
+	}
+	if replay, _ := GlobalFlags.GetString("rsh-replay"); replay != "" {
+		viper.Set("rsh-replay", replay)
+	}
+	if headers, _ := GlobalFlags.GetStringArray("rsh-match-header"); len(headers) > 0 {
+		viper.Set("rsh-match-header", headers)
+	}
+	if session, _ := GlobalFlags.GetString("rsh-cassette-session"); session != "" {
+		viper.Set("rsh-cassette-session", session)
+	}
 
 	// Now that global flags are parsed we can enable verbose mode if requested.
 	if viper.GetBool("rsh-verbose") {
@@ -845,6 +999,10 @@ func Run() (returnErr error) {
 	// and all the relevant sub-commands are registered.
 	defer func() {
 		if err := recover(); err != nil {
+			if e, ok := err.(error); ok && errors.Is(e, ErrDryRun) {
+				// The request was printed instead of being sent.
+				return
+			}
 			LogError("Caught error: %v", err)
 			LogDebug("%s", string(debug.Stack()))
 			if e, ok := err.(error); ok {
@@ -863,7 +1021,17 @@ func Run() (returnErr error) {
 }
 
 // GetExitCode returns the exit code to use based on the last HTTP status code.
+// When expectations, e.g. from `--rsh-expect`, have been evaluated they decide
+// the exit code instead.
 func GetExitCode() int {
+	if expectationFailed {
+		return ExitCodeExpectationFailed
+	}
+
+	if expectationsChecked {
+		return 0
+	}
+
 	if s := GetLastStatus() / 100; s > 2 && !viper.GetBool("rsh-ignore-status-code") {
 		return s
 	}
@@ -1,7 +1,9 @@
 package cli
 
 import (
+	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,6 +13,7 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/h2non/gock.v1"
 )
 
@@ -51,6 +54,32 @@ func runNoReset(cmd string) string {
 	return capture.String()
 }
 
+// jsonServer starts a test server which responds with the status code and
+// JSON body returned by the handler, or no body if it is nil. The server is
+// closed once the test finishes.
+func jsonServer(t *testing.T, handler func(r *http.Request) (int, any)) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status, body := handler(r)
+		if body == nil {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writeTestFile writes the lines to a file with the given name in a new
+// temporary directory and returns its path.
+func writeTestFile(t *testing.T, name string, lines ...string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(filename, []byte(strings.Join(lines, "\n")), 0600))
+	return filename
+}
+
 func expectJSON(t *testing.T, cmd string, expected string) {
 	captured := run("-o json -f body " + cmd)
 	assert.JSONEq(t, expected, captured)
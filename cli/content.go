@@ -1,10 +1,12 @@
 package cli
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"sort"
 	"strings"
@@ -30,6 +32,13 @@ type PrettyMarshaller interface {
 	MarshalPretty(value any) ([]byte, error)
 }
 
+// StreamUnmarshaller describes an optional method that ContentTypes can
+// implement to decode a body incrementally as it arrives, for example one line
+// at a time. The handler is called with each decoded value.
+type StreamUnmarshaller interface {
+	UnmarshalStream(r io.Reader, handler func(value any) error) error
+}
+
 type contentTypeEntry struct {
 	name string
 	q    float32
@@ -63,12 +72,31 @@ func buildAcceptHeader() string {
 	return strings.Join(accept, ",")
 }
 
+// findContentType returns the most preferred registered content type which
+// can handle the given content type, e.g. `application/json`. Output-only
+// formats like `table` are skipped since they are not sent over the wire.
+func findContentType(contentType string) ContentType {
+	var found *contentTypeEntry
+	var foundShort string
+	for short, entry := range contentTypes {
+		if entry.q < 0 || !entry.ct.Detect(contentType) {
+			continue
+		}
+		if found == nil || entry.q > found.q || (entry.q == found.q && short < foundShort) {
+			found, foundShort = &entry, short
+		}
+	}
+
+	if found == nil {
+		return nil
+	}
+	return found.ct
+}
+
 // Marshal a value to the given content type, e.g. `application/json`.
 func Marshal(contentType string, value interface{}) ([]byte, error) {
-	for _, entry := range contentTypes {
-		if entry.ct.Detect(contentType) {
-			return entry.ct.Marshal(value)
-		}
+	if ct := findContentType(contentType); ct != nil {
+		return ct.Marshal(value)
 	}
 
 	return nil, fmt.Errorf("cannot marshal %s", contentType)
@@ -112,6 +140,20 @@ func Unmarshal(contentType string, data []byte, value interface{}) error {
 	return fmt.Errorf("cannot unmarshal %s", contentType)
 }
 
+// getStreamUnmarshaller returns a stream unmarshaller for the given content
+// type, or nil if the content type does not support incremental decoding.
+func getStreamUnmarshaller(contentType string) StreamUnmarshaller {
+	for _, entry := range contentTypes {
+		if entry.ct.Detect(contentType) {
+			if su, ok := entry.ct.(StreamUnmarshaller); ok {
+				return su
+			}
+		}
+	}
+
+	return nil
+}
+
 type stringer interface {
 	String() string
 }
@@ -321,6 +363,91 @@ func (j JSON) Unmarshal(data []byte, value interface{}) error {
 	return json.Unmarshal(data, value)
 }
 
+// NDJSON describes newline-delimited JSON content types like
+// `application/x-ndjson` or `application/jsonl`, where each line is a
+// separate JSON value. https://jsonlines.org/
+type NDJSON struct{}
+
+// Detect if the content type is newline-delimited JSON.
+func (n NDJSON) Detect(contentType string) bool {
+	first := strings.Split(contentType, ";")[0]
+	if first == "application/x-ndjson" || first == "application/ndjson" || first == "application/jsonl" || first == "application/x-jsonl" || first == "application/jsonlines" || strings.HasSuffix(first, "+jsonl") {
+		return true
+	}
+
+	return false
+}
+
+// Marshal the value to encoded JSON lines. Arrays are written with one item
+// per line, while any other value is written as a single line.
+func (n NDJSON) Marshal(value interface{}) ([]byte, error) {
+	items, ok := makeJSONSafe(value).([]interface{})
+	if !ok {
+		return JSON{}.Marshal(value)
+	}
+
+	buf := &bytes.Buffer{}
+	for _, item := range items {
+		b, err := JSON{}.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal the value from encoded JSON lines into an array of items.
+func (n NDJSON) Unmarshal(data []byte, value interface{}) error {
+	items := []json.RawMessage{}
+	if err := n.eachLine(bytes.NewReader(data), func(line []byte) error {
+		items = append(items, line)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	// Re-encode as a JSON array so that any type of value can be the target.
+	b, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, value)
+}
+
+// UnmarshalStream decodes one JSON value per line from the reader, calling
+// the handler as soon as each line has been received.
+func (n NDJSON) UnmarshalStream(r io.Reader, handler func(value any) error) error {
+	return n.eachLine(r, func(line []byte) error {
+		var item any
+		if err := json.Unmarshal(line, &item); err != nil {
+			return err
+		}
+		return handler(item)
+	})
+}
+
+// eachLine calls the handler with each non-blank line from the reader.
+func (n NDJSON) eachLine(r io.Reader, handler func(line []byte) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			if err := handler(trimmed); err != nil {
+				return err
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
 // YAML describes content types like `application/yaml` or
 // `application/foo+yaml`.
 type YAML struct{}
@@ -15,6 +15,7 @@ var contentTests = []struct {
 }{
 	{"text", []string{"text/plain", "text/html"}, &Text{}, []byte("hello world"), nil},
 	{"json", []string{"application/json", "foo+json"}, &JSON{}, []byte("{\"hello\":\"world\"}\n"), []byte("{\n  \"hello\": \"world\"\n}\n")},
+	{"jsonl", []string{"application/x-ndjson", "application/jsonl", "foo+jsonl"}, &NDJSON{}, []byte("{\"hello\":\"world\"}\n[1,2]\n"), nil},
 	{"yaml", []string{"application/yaml", "foo+yaml"}, &YAML{}, []byte("hello: world\n"), nil},
 	{"cbor", []string{"application/cbor", "foo+cbor"}, &CBOR{}, []byte("\xf6"), nil},
 	{"msgpack", []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack", "foo+msgpack"}, &MsgPack{}, []byte("\x81\xa5\x68\x65\x6c\x6c\x6f\xa5\x77\x6f\x72\x6c\x64"), nil},
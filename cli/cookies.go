@@ -0,0 +1,301 @@
+package cli
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/net/publicsuffix"
+)
+
+// storedCookie is a cookie saved in a cookie jar file. Unlike `http.Cookie`
+// it keeps the effective domain & path, which may come from the request URL
+// rather than the cookie attributes.
+type storedCookie struct {
+	Name     string     `json:"name" yaml:"name"`
+	Value    string     `json:"value" yaml:"value"`
+	Domain   string     `json:"domain" yaml:"domain"`
+	Path     string     `json:"path" yaml:"path"`
+	HostOnly bool       `json:"host_only,omitempty" yaml:"host_only,omitempty"`
+	Secure   bool       `json:"secure,omitempty" yaml:"secure,omitempty"`
+	HttpOnly bool       `json:"http_only,omitempty" yaml:"http_only,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty" yaml:"expires,omitempty"`
+	Created  time.Time  `json:"created" yaml:"created"`
+}
+
+func (c *storedCookie) expired(now time.Time) bool {
+	return c.Expires != nil && !c.Expires.After(now)
+}
+
+// matches returns whether the cookie should be sent to the given URL.
+func (c *storedCookie) matches(host, path string, secure bool) bool {
+	if c.Secure && !secure {
+		return false
+	}
+
+	if c.HostOnly {
+		if host != c.Domain {
+			return false
+		}
+	} else if host != c.Domain && !strings.HasSuffix(host, "."+c.Domain) {
+		return false
+	}
+
+	// The path must match exactly or be a sub-path on a `/` boundary.
+	if path == c.Path {
+		return true
+	}
+	return strings.HasPrefix(path, c.Path) && (strings.HasSuffix(c.Path, "/") || path[len(c.Path)] == '/')
+}
+
+// cookieJar is a persistent `http.CookieJar` which saves cookies to disk after
+// every change so they can be used in subsequent runs.
+type cookieJar struct {
+	mu      sync.Mutex
+	path    string
+	cookies []*storedCookie
+}
+
+var cookieJarsMu sync.Mutex
+var cookieJars = map[string]*cookieJar{}
+
+// cookieJarPath returns the file used to store cookies for an API profile.
+func cookieJarPath(apiName, profile string) string {
+	return filepath.Join(viper.GetString("cache-dir"), "cookies", apiName, profile+".json")
+}
+
+// getCookieJar returns the cookie jar for an API profile, loading any
+// previously saved cookies from disk.
+func getCookieJar(apiName, profile string) (*cookieJar, error) {
+	cookieJarsMu.Lock()
+	defer cookieJarsMu.Unlock()
+
+	path := cookieJarPath(apiName, profile)
+	if jar := cookieJars[path]; jar != nil {
+		return jar, nil
+	}
+
+	jar := &cookieJar{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &jar.cookies); err != nil {
+			return nil, err
+		}
+	}
+	cookieJars[path] = jar
+
+	return jar, nil
+}
+
+// clearCookieJar removes all stored cookies for an API profile.
+func clearCookieJar(apiName, profile string) error {
+	cookieJarsMu.Lock()
+	defer cookieJarsMu.Unlock()
+
+	path := cookieJarPath(apiName, profile)
+	delete(cookieJars, path)
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List returns all unexpired cookies in the jar.
+func (j *cookieJar) List() []*storedCookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	cookies := []*storedCookie{}
+	for _, c := range j.cookies {
+		if !c.expired(now) {
+			cookies = append(cookies, c)
+		}
+	}
+	return cookies
+}
+
+// save writes the unexpired cookies to disk. The lock must be held.
+func (j *cookieJar) save() error {
+	now := time.Now()
+	cookies := []*storedCookie{}
+	for _, c := range j.cookies {
+		if !c.expired(now) {
+			cookies = append(cookies, c)
+		}
+	}
+	j.cookies = cookies
+
+	data, err := json.MarshalIndent(cookies, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.path), 0700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(j.path, data, 0600)
+}
+
+// cookieHost returns the canonical host used to match cookies.
+func cookieHost(u *url.URL) string {
+	return strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+}
+
+// cookieDomain returns the effective domain for a cookie and whether it should
+// only be sent to the exact host. It returns false if the cookie must be
+// rejected, e.g. when setting a cookie for another site or a public suffix
+// like `co.uk`.
+func cookieDomain(host, domain string) (string, bool, bool) {
+	if domain == "" {
+		return host, true, true
+	}
+
+	domain = strings.TrimSuffix(strings.TrimPrefix(strings.ToLower(domain), "."), ".")
+
+	if net.ParseIP(host) != nil {
+		// IP addresses must match exactly.
+		return host, true, domain == host
+	}
+
+	if suffix, _ := publicsuffix.PublicSuffix(domain); suffix == domain {
+		// A public suffix can only be used as a host-only cookie for itself.
+		return host, true, domain == host
+	}
+
+	if host != domain && !strings.HasSuffix(host, "."+domain) {
+		return "", false, false
+	}
+
+	return domain, false, true
+}
+
+// cookieDefaultPath returns the default cookie path for a request path, which
+// is the "directory" of the path.
+func cookieDefaultPath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
+}
+
+// SetCookies saves cookies received in a response from the given URL.
+func (j *cookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	if len(cookies) == 0 {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := cookieHost(u)
+	now := time.Now()
+
+	for _, c := range cookies {
+		domain, hostOnly, ok := cookieDomain(host, c.Domain)
+		if !ok {
+			LogDebug("Ignoring cookie %s for domain %s from %s", c.Name, c.Domain, host)
+			continue
+		}
+
+		path := c.Path
+		if path == "" || path[0] != '/' {
+			path = cookieDefaultPath(u.Path)
+		}
+
+		stored := &storedCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Domain:   domain,
+			Path:     path,
+			HostOnly: hostOnly,
+			Secure:   c.Secure,
+			HttpOnly: c.HttpOnly,
+			Created:  now,
+		}
+
+		// Max-Age takes precedence over Expires. Both are stored as an absolute
+		// time so they remain correct in later runs.
+		if c.MaxAge < 0 {
+			stored.Expires = &now
+		} else if c.MaxAge > 0 {
+			expires := now.Add(time.Duration(c.MaxAge) * time.Second)
+			stored.Expires = &expires
+		} else if !c.Expires.IsZero() {
+			expires := c.Expires
+			stored.Expires = &expires
+		}
+
+		// Replace any existing cookie with the same name, domain & path. An
+		// expired cookie removes it from the jar.
+		replaced := false
+		for i, existing := range j.cookies {
+			if existing.Name == stored.Name && existing.Domain == stored.Domain && existing.Path == stored.Path {
+				stored.Created = existing.Created
+				j.cookies[i] = stored
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			j.cookies = append(j.cookies, stored)
+		}
+	}
+
+	if err := j.save(); err != nil {
+		LogWarning("Unable to save cookies: %v", err)
+	}
+}
+
+// Cookies returns the cookies to send in a request to the given URL.
+func (j *cookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	host := cookieHost(u)
+	secure := u.Scheme == "https" || u.Scheme == "wss"
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	now := time.Now()
+	matched := []*storedCookie{}
+	for _, c := range j.cookies {
+		if !c.expired(now) && c.matches(host, path, secure) {
+			matched = append(matched, c)
+		}
+	}
+
+	// Cookies with longer paths are listed first, then by creation time.
+	sort.SliceStable(matched, func(a, b int) bool {
+		if len(matched[a].Path) != len(matched[b].Path) {
+			return len(matched[a].Path) > len(matched[b].Path)
+		}
+		return matched[a].Created.Before(matched[b].Created)
+	})
+
+	cookies := make([]*http.Cookie, 0, len(matched))
+	for _, c := range matched {
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value})
+	}
+	return cookies
+}
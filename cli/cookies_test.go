@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func cookieNames(cookies []*http.Cookie) []string {
+	names := []string{}
+	for _, c := range cookies {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func TestCookieJarRules(t *testing.T) {
+	jar := &cookieJar{path: t.TempDir() + "/cookies.json"}
+
+	u, _ := url.Parse("https://api.example.com/v1/items")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "domain", Value: "2", Domain: ".example.com"},
+		{Name: "root", Value: "3", Path: "/"},
+		{Name: "secure", Value: "4", Secure: true, Path: "/"},
+		{Name: "expired", Value: "5", Expires: time.Now().Add(-time.Hour)},
+		{Name: "maxage", Value: "6", MaxAge: 3600, Path: "/"},
+		{Name: "other", Value: "7", Domain: "other.com"},
+		{Name: "suffix", Value: "8", Domain: "com"},
+	})
+
+	// Default path is the request path's directory.
+	assert.Equal(t, []string{"host", "domain", "root", "secure", "maxage"}, cookieNames(jar.Cookies(u)))
+
+	u, _ = url.Parse("https://api.example.com/v2")
+	assert.Equal(t, []string{"root", "secure", "maxage"}, cookieNames(jar.Cookies(u)))
+
+	// Secure cookies are only sent over HTTPS.
+	u, _ = url.Parse("http://api.example.com/v1/items")
+	assert.Equal(t, []string{"host", "domain", "root", "maxage"}, cookieNames(jar.Cookies(u)))
+
+	// Domain cookies are sent to sub-domains, host-only cookies are not.
+	u, _ = url.Parse("https://www.example.com/v1/")
+	assert.Equal(t, []string{"domain"}, cookieNames(jar.Cookies(u)))
+
+	u, _ = url.Parse("https://other.com/")
+	assert.Empty(t, jar.Cookies(u))
+
+	// Cookies are replaced or removed by name, domain & path.
+	u, _ = url.Parse("https://api.example.com/")
+	jar.SetCookies(u, []*http.Cookie{
+		{Name: "root", Value: "updated"},
+		{Name: "maxage", MaxAge: -1},
+	})
+	cookies := jar.Cookies(u)
+	assert.Equal(t, []string{"root", "secure"}, cookieNames(cookies))
+	assert.Equal(t, "updated", cookies[0].Value)
+}
+
+func TestCookiesPersist(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	viper.Set("cache-dir", t.TempDir())
+	defer delete(configs, "cookie-test")
+	configs["cookie-test"] = &APIConfig{
+		name:    "cookie-test",
+		Base:    "https://cookies.example.com",
+		Cookies: true,
+	}
+
+	gock.New("https://cookies.example.com").
+		Post("/login").
+		Reply(http.StatusNoContent).
+		SetHeader("Set-Cookie", "session=abc123; Path=/; Secure; HttpOnly")
+
+	gock.New("https://cookies.example.com").
+		Get("/me").
+		MatchHeader("Cookie", "session=abc123").
+		Reply(http.StatusOK).
+		JSON(map[string]any{"name": "test"})
+
+	captured := runNoReset("post https://cookies.example.com/login")
+	assert.Contains(t, captured, "204 No Content")
+
+	// A new run must load the cookies from disk.
+	cookieJars = map[string]*cookieJar{}
+	captured = runNoReset("https://cookies.example.com/me")
+	assert.Contains(t, captured, "200 OK")
+
+	captured = runNoReset("api cookies show cookie-test")
+	assert.Contains(t, captured, `"name": "session"`)
+	assert.Contains(t, captured, `"domain": "cookies.example.com"`)
+
+	runNoReset("api cookies clear cookie-test")
+	_, err := os.Stat(cookieJarPath("cookie-test", "default"))
+	assert.True(t, os.IsNotExist(err))
+
+	captured = runNoReset("api cookies show cookie-test")
+	assert.Equal(t, "[]\n", captured)
+
+	captured = runNoReset("api cookies show missing-api")
+	assert.Contains(t, captured, "API missing-api not found")
+}
@@ -0,0 +1,534 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/danielgtaylor/shorthand/v2"
+	"github.com/google/shlex"
+)
+
+// curlRequest is a request parsed from a curl command.
+type curlRequest struct {
+	method  string
+	url     string
+	headers [][2]string
+
+	// Only one of `shorthand` or `raw` is set for requests with a body.
+	shorthand string
+	raw       []byte
+
+	// tls and auth are set from curl options and used only for this request.
+	tls  TLSConfig
+	auth *APIAuth
+}
+
+// curlIgnored are curl options without a value which don't affect the
+// request, e.g. because restish always behaves that way.
+var curlIgnored = map[string]bool{
+	"-L": true, "--location": true, "--compressed": true,
+	"-s": true, "--silent": true, "-S": true, "--show-error": true,
+	"-v": true, "--verbose": true, "-i": true, "--include": true,
+	"-f": true, "--fail": true, "-N": true, "--no-buffer": true,
+	"--http1.1": true, "--http2": true, "-g": true, "--globoff": true,
+}
+
+// curlShortWithValue are short curl options which take a value.
+var curlShortWithValue = "XHdFuAebEo"
+
+// curlHasValue returns whether a curl option takes a value.
+func curlHasValue(name string) bool {
+	if len(name) == 2 {
+		return strings.ContainsRune(curlShortWithValue, rune(name[1]))
+	}
+
+	switch name {
+	case "--request", "--header", "--data", "--data-raw", "--data-binary",
+		"--data-ascii", "--data-urlencode", "--json", "--form", "--user",
+		"--user-agent", "--referer", "--cookie", "--cert", "--key", "--cacert",
+		"--url", "--output":
+		return true
+	}
+	return false
+}
+
+// splitCurlArgs splits a curl command into options with their values and
+// positional arguments. Combined short options like `-sSL` and attached
+// values like `-XPOST` or `--request=POST` are expanded.
+func splitCurlArgs(args []string) ([][2]string, error) {
+	result := [][2]string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			result = append(result, [2]string{"", arg})
+			continue
+		}
+
+		if strings.HasPrefix(arg, "--") {
+			if name, value, ok := strings.Cut(arg, "="); ok && curlHasValue(name) {
+				result = append(result, [2]string{name, value})
+				continue
+			}
+			if curlHasValue(arg) {
+				if i+1 >= len(args) {
+					return nil, fmt.Errorf("curl option %s needs a value", arg)
+				}
+				i++
+				result = append(result, [2]string{arg, args[i]})
+				continue
+			}
+			result = append(result, [2]string{arg, ""})
+			continue
+		}
+
+		// Short options may be combined, and the last one may have a value.
+		for j := 1; j < len(arg); j++ {
+			name := "-" + string(arg[j])
+			if curlHasValue(name) {
+				value := arg[j+1:]
+				if value == "" {
+					if i+1 >= len(args) {
+						return nil, fmt.Errorf("curl option %s needs a value", name)
+					}
+					i++
+					value = args[i]
+				}
+				result = append(result, [2]string{name, value})
+				break
+			}
+			result = append(result, [2]string{name, ""})
+		}
+	}
+
+	return result, nil
+}
+
+// readCurlData returns the data for a curl `-d` style option, loading it
+// from a file if it starts with `@`.
+func readCurlData(value string, stripNewlines bool) (string, error) {
+	if !strings.HasPrefix(value, "@") {
+		return value, nil
+	}
+
+	var b []byte
+	var err error
+	if value == "@-" {
+		b, err = io.ReadAll(Stdin)
+	} else {
+		b, err = os.ReadFile(value[1:])
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if stripNewlines {
+		b = bytes.ReplaceAll(bytes.ReplaceAll(b, []byte("\r"), nil), []byte("\n"), nil)
+	}
+	return string(b), nil
+}
+
+// parseCurl parses a curl command line into a request.
+func parseCurl(command []string) (*curlRequest, error) {
+	if len(command) > 0 && command[0] == "curl" {
+		command = command[1:]
+	}
+
+	opts, err := splitCurlArgs(command)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &curlRequest{}
+	data := []string{}
+	form := map[string]any{}
+	formKeys := 0
+	toQuery := false
+	head := false
+	contentType := ""
+
+	for _, opt := range opts {
+		name, value := opt[0], opt[1]
+		switch name {
+		case "":
+			if r.url != "" {
+				return nil, fmt.Errorf("only one URL is supported, got %s and %s", r.url, value)
+			}
+			r.url = value
+		case "--url":
+			r.url = value
+		case "-X", "--request":
+			r.method = strings.ToUpper(value)
+		case "-H", "--header":
+			hName, hValue, ok := strings.Cut(value, ":")
+			if !ok {
+				return nil, fmt.Errorf("unsupported curl header %q", value)
+			}
+			hName = strings.TrimSpace(hName)
+			hValue = strings.TrimSpace(hValue)
+			if strings.EqualFold(hName, "content-type") {
+				contentType = hValue
+			}
+			r.headers = append(r.headers, [2]string{hName, hValue})
+		case "-d", "--data", "--data-ascii", "--data-binary", "--data-raw", "--json":
+			d := value
+			if name != "--data-raw" {
+				if d, err = readCurlData(value, name == "-d" || name == "--data" || name == "--data-ascii"); err != nil {
+					return nil, err
+				}
+			}
+			if name == "--json" && contentType == "" {
+				contentType = "application/json"
+				r.headers = append(r.headers, [2]string{"Content-Type", contentType}, [2]string{"Accept", "application/json"})
+			}
+			data = append(data, d)
+		case "--data-urlencode":
+			if k, v, ok := strings.Cut(value, "="); ok {
+				data = append(data, url.QueryEscape(k)+"="+url.QueryEscape(v))
+			} else {
+				data = append(data, url.QueryEscape(value))
+			}
+		case "-F", "--form":
+			k, v, ok := strings.Cut(value, "=")
+			if !ok {
+				return nil, fmt.Errorf("unsupported curl form field %q", value)
+			}
+			if strings.HasPrefix(v, "@") {
+				// Only the `;type=...` option is supported for files, otherwise the
+				// type is detected from the file.
+				parts := strings.Split(v, ";")
+				v = parts[0]
+				for _, o := range parts[1:] {
+					if !strings.HasPrefix(o, "type=") {
+						return nil, fmt.Errorf("unsupported curl form option %q in %q", o, value)
+					}
+					v += ";" + o
+				}
+			} else if strings.HasPrefix(v, "<") {
+				if v, err = readCurlData("@"+v[1:], false); err != nil {
+					return nil, err
+				}
+			}
+			if existing, ok := form[k]; ok {
+				if list, ok := existing.([]any); ok {
+					form[k] = append(list, v)
+				} else {
+					form[k] = []any{existing, v}
+				}
+			} else {
+				form[k] = v
+			}
+			formKeys++
+		case "-u", "--user":
+			// Without a password, curl prompts for it and so does restish.
+			username, password, ok := strings.Cut(value, ":")
+			params := map[string]string{"username": username}
+			if ok {
+				params["password"] = password
+			}
+			r.auth = &APIAuth{Name: "http-basic", Params: params}
+		case "-A", "--user-agent":
+			r.headers = append(r.headers, [2]string{"User-Agent", value})
+		case "-e", "--referer":
+			r.headers = append(r.headers, [2]string{"Referer", value})
+		case "-b", "--cookie":
+			if !strings.Contains(value, "=") {
+				return nil, fmt.Errorf("curl cookie files are not supported")
+			}
+			r.headers = append(r.headers, [2]string{"Cookie", value})
+		case "-k", "--insecure":
+			r.tls.InsecureSkipVerify = true
+		case "-E", "--cert":
+			r.tls.Cert, _, _ = strings.Cut(value, ":")
+		case "--key":
+			r.tls.Key = value
+		case "--cacert":
+			r.tls.CACert = value
+		case "-G", "--get":
+			toQuery = true
+		case "-I", "--head":
+			head = true
+		case "-o", "--output":
+			// Output is handled by restish.
+		default:
+			if !curlIgnored[name] {
+				return nil, fmt.Errorf("unsupported curl option %s", name)
+			}
+		}
+	}
+
+	if r.url == "" {
+		return nil, fmt.Errorf("no URL found in curl command")
+	}
+	if !strings.Contains(r.url, "://") {
+		// Curl defaults to HTTP, restish to HTTPS.
+		r.url = "http://" + r.url
+	}
+
+	switch {
+	case r.method != "":
+	case head:
+		r.method = http.MethodHead
+	case toQuery:
+		r.method = http.MethodGet
+	case len(data) > 0 || formKeys > 0:
+		r.method = http.MethodPost
+	default:
+		r.method = http.MethodGet
+	}
+
+	if toQuery && len(data) > 0 {
+		sep := "?"
+		if strings.Contains(r.url, "?") {
+			sep = "&"
+		}
+		r.url += sep + strings.Join(data, "&")
+		data = nil
+	}
+
+	if formKeys > 0 {
+		if len(data) > 0 {
+			return nil, fmt.Errorf("curl data and form options can't be combined")
+		}
+		r.headers = append(r.headers, [2]string{"Content-Type", "multipart/form-data"})
+		r.shorthand = toShorthand(form, map[string]any{})
+		return r, nil
+	}
+
+	if len(data) > 0 {
+		body := strings.Join(data, "&")
+		r.raw = []byte(body)
+
+		var parsed any
+		mt := strings.ToLower(contentType)
+		switch {
+		case (mt == "" || (&JSON{}).Detect(mt)) && json.Unmarshal([]byte(body), &parsed) == nil:
+			// Curl sends JSON data as a form unless told otherwise, but that's
+			// almost never what was meant, so let restish default to JSON.
+			r.shorthand = toShorthand(parsed, parsed)
+		case mt == "" || strings.HasPrefix(mt, "application/x-www-form-urlencoded"):
+			if values, ok := parseCurlForm(body); ok {
+				if contentType == "" {
+					r.headers = append(r.headers, [2]string{"Content-Type", "application/x-www-form-urlencoded"})
+				}
+				r.shorthand = toShorthand(values, values)
+			} else if contentType == "" {
+				r.headers = append(r.headers, [2]string{"Content-Type", "application/x-www-form-urlencoded"})
+			}
+		}
+
+		if r.shorthand != "" {
+			r.raw = nil
+		}
+	}
+
+	return r, nil
+}
+
+// parseCurlForm converts URL-encoded form data into a map, if every field
+// has a name and value.
+func parseCurlForm(body string) (map[string]any, bool) {
+	values := map[string]any{}
+	for _, pair := range strings.Split(body, "&") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, false
+		}
+		k, err1 := url.QueryUnescape(k)
+		v, err2 := url.QueryUnescape(v)
+		if err1 != nil || err2 != nil {
+			return nil, false
+		}
+		if existing, ok := values[k]; ok {
+			if list, ok := existing.([]any); ok {
+				values[k] = append(list, v)
+			} else {
+				values[k] = []any{existing, v}
+			}
+		} else {
+			values[k] = v
+		}
+	}
+	return values, true
+}
+
+// toShorthand converts a value to CLI shorthand. If the shorthand would not
+// be parsed back into the expected value, e.g. due to special characters,
+// then JSON is used instead, since it's also valid shorthand. The expected
+// value differs from the input for multipart forms, where `@file` values
+// are meant to load files.
+func toShorthand(value any, expected any) string {
+	sh := shorthand.Marshal(value, shorthand.MarshalOptions{Spacer: " "})
+	if m, ok := value.(map[string]any); ok && len(m) > 1 {
+		// Strip the braces from top-level objects, like restish examples.
+		sh = sh[1 : len(sh)-1]
+	}
+
+	options := shorthand.ParseOptions{EnableFileInput: true, EnableObjectDetection: true, ForceStringKeys: true}
+	if m, ok := expected.(map[string]any); ok && len(m) == 0 {
+		// Files are loaded when the request is made, so can't be checked.
+		return sh
+	}
+	if parsed, err := shorthand.Unmarshal(sh, options, nil); err == nil && jsonEqual(parsed, expected) {
+		return sh
+	}
+
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+// jsonEqual returns whether two values are equal once converted to JSON,
+// which normalizes differences like number types.
+func jsonEqual(a, b any) bool {
+	var na, nb any
+	ja, err1 := json.Marshal(a)
+	jb, err2 := json.Marshal(b)
+	if err1 != nil || err2 != nil || json.Unmarshal(ja, &na) != nil || json.Unmarshal(jb, &nb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(na, nb)
+}
+
+// Command returns an equivalent restish command line.
+func (r *curlRequest) Command() (string, error) {
+	switch r.method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodOptions:
+	default:
+		return "", fmt.Errorf("method %s is not supported by restish", r.method)
+	}
+
+	parts := []string{"restish", strings.ToLower(r.method), shellQuote(r.url)}
+	for _, h := range r.headers {
+		parts = append(parts, "-H", shellQuote(h[0]+":"+h[1]))
+	}
+	if r.auth != nil {
+		// There is no flag for auth, which is usually set up in the API's
+		// profile, so send the header it would create.
+		password, ok := r.auth.Params["password"]
+		if !ok {
+			return "", fmt.Errorf("curl prompts for the password of %s, set up http-basic auth for the API instead", r.auth.Params["username"])
+		}
+		credentials := base64.StdEncoding.EncodeToString([]byte(r.auth.Params["username"] + ":" + password))
+		parts = append(parts, "-H", shellQuote("Authorization:Basic "+credentials))
+	}
+	if r.tls.InsecureSkipVerify {
+		parts = append(parts, "--rsh-insecure")
+	}
+	for _, f := range [][2]string{{"rsh-client-cert", r.tls.Cert}, {"rsh-client-key", r.tls.Key}, {"rsh-ca-cert", r.tls.CACert}} {
+		if f[1] != "" {
+			parts = append(parts, "--"+f[0], shellQuote(f[1]))
+		}
+	}
+
+	cmd := strings.Join(parts, " ")
+	if r.shorthand != "" {
+		cmd += " " + shellQuote(r.shorthand)
+	}
+	if r.raw != nil {
+		cmd = "printf '%s' " + shellQuote(string(r.raw)) + " | " + cmd
+	}
+
+	return cmd, nil
+}
+
+// Request builds the HTTP request.
+func (r *curlRequest) Request() (*http.Request, error) {
+	contentType := ""
+	for _, h := range r.headers {
+		if strings.EqualFold(h[0], "content-type") {
+			contentType = h[1]
+		}
+	}
+
+	var body io.Reader
+	if r.shorthand != "" {
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		var err error
+		if body, contentType, err = GetBodyReader(contentType, []string{r.shorthand}); err != nil {
+			return nil, err
+		}
+	} else if r.raw != nil {
+		body = bytes.NewReader(r.raw)
+	}
+
+	req, err := http.NewRequest(r.method, r.url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, h := range r.headers {
+		if !strings.EqualFold(h[0], "content-type") {
+			req.Header.Add(h[0], h[1])
+		}
+	}
+	if body != nil {
+		setBodyContentType(req, body, contentType)
+	}
+
+	return req, nil
+}
+
+// options returns the request options for curl options like TLS settings
+// and auth, which only apply to this request.
+func (r *curlRequest) options() []requestOption {
+	options := []requestOption{WithTLS(&r.tls)}
+	if r.auth != nil {
+		options = append(options, WithAuth(r.auth))
+	}
+	return options
+}
+
+// fromCurl parses a curl command and either prints the equivalent restish
+// command or makes the request. The command may be a single string, which
+// is split like a shell would, or already split into arguments.
+func fromCurl(args []string, print bool) {
+	if len(args) == 0 {
+		if info, err := Stdin.Stat(); err == nil && (info.Mode()&os.ModeCharDevice) == 0 {
+			b, err := io.ReadAll(Stdin)
+			if err != nil {
+				panic(err)
+			}
+			args = []string{string(b)}
+		}
+	}
+
+	if len(args) == 1 {
+		// Remove line continuations, e.g. from copying a command from docs.
+		command := strings.NewReplacer("\\\r\n", " ", "\\\n", " ").Replace(args[0])
+		split, err := shlex.Split(command)
+		if err != nil {
+			panic(fmt.Errorf("unable to parse curl command: %w", err))
+		}
+		args = split
+	}
+
+	r, err := parseCurl(args)
+	if err != nil {
+		panic(err)
+	}
+
+	if print {
+		cmd, err := r.Command()
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintln(Stdout, cmd)
+		return
+	}
+
+	req, err := r.Request()
+	if err != nil {
+		panic(err)
+	}
+	MakeRequestAndFormat(req, r.options()...)
+}
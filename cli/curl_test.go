@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestSplitCurlArgs(t *testing.T) {
+	opts, err := splitCurlArgs([]string{"-sSXPOST", "--header=A: b", "-H", "C: d", "https://example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]string{
+		{"-s", ""},
+		{"-S", ""},
+		{"-X", "POST"},
+		{"--header", "A: b"},
+		{"-H", "C: d"},
+		{"", "https://example.com"},
+	}, opts)
+
+	_, err = splitCurlArgs([]string{"-H"})
+	assert.ErrorContains(t, err, "needs a value")
+}
+
+func TestCurlCommand(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		args    []string
+		command string
+	}{
+		{
+			name:    "get",
+			args:    []string{"curl", "-sL", "example.com/items"},
+			command: `restish get 'http://example.com/items'`,
+		},
+		{
+			name:    "json",
+			args:    []string{"curl", "-X", "PUT", "https://example.com/items/1", "-H", "Content-Type: application/json", "-d", `{"name": "foo", "tags": ["a"], "id": "123"}`},
+			command: `restish put 'https://example.com/items/1' -H 'Content-Type:application/json' 'id: "123", name: foo, tags: [a]'`,
+		},
+		{
+			name:    "json-special",
+			args:    []string{"curl", "--json", `{"q": "a, b: c"}`, "https://example.com/search"},
+			command: `restish post 'https://example.com/search' -H 'Content-Type:application/json' -H 'Accept:application/json' '{"q":"a, b: c"}'`,
+		},
+		{
+			name:    "form",
+			args:    []string{"curl", "-d", "a=1", "--data-urlencode", "b=two words", "https://example.com/form"},
+			command: `restish post 'https://example.com/form' -H 'Content-Type:application/x-www-form-urlencoded' 'a: "1", b: two words'`,
+		},
+		{
+			name:    "query",
+			args:    []string{"curl", "-G", "-d", "a=1", "https://example.com/search?q=x"},
+			command: `restish get 'https://example.com/search?q=x&a=1'`,
+		},
+		{
+			name:    "multipart",
+			args:    []string{"curl", "-F", "name=foo", "-F", "file=@logo.png;type=image/png", "https://example.com/upload"},
+			command: `restish post 'https://example.com/upload' -H 'Content-Type:multipart/form-data' 'file: @logo.png;type=image/png, name: foo'`,
+		},
+		{
+			name:    "raw",
+			args:    []string{"curl", "--data-binary", "it's raw", "-H", "Content-Type: text/plain", "https://example.com/raw"},
+			command: `printf '%s' 'it'\''s raw' | restish post 'https://example.com/raw' -H 'Content-Type:text/plain'`,
+		},
+		{
+			name:    "auth-tls",
+			args:    []string{"curl", "-u", "alice:secret", "-k", "--cert", "client.pem", "--key", "client.key", "--cacert", "ca.pem", "https://example.com/"},
+			command: `restish get 'https://example.com/' -H 'Authorization:Basic YWxpY2U6c2VjcmV0' --rsh-insecure --rsh-client-cert 'client.pem' --rsh-client-key 'client.key' --rsh-ca-cert 'ca.pem'`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := parseCurl(tc.args)
+			assert.NoError(t, err)
+			command, err := r.Command()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.command, command)
+		})
+	}
+}
+
+func TestCurlErrors(t *testing.T) {
+	_, err := parseCurl([]string{"curl", "--trace", "out.txt", "https://example.com"})
+	assert.ErrorContains(t, err, "unsupported curl option --trace")
+
+	_, err = parseCurl([]string{"curl", "-X", "GET"})
+	assert.ErrorContains(t, err, "no URL")
+
+	r, err := parseCurl([]string{"curl", "-X", "PURGE", "https://example.com"})
+	assert.NoError(t, err)
+	_, err = r.Command()
+	assert.ErrorContains(t, err, "not supported")
+
+	_, err = parseCurl([]string{"curl", "-F", "file=@logo.png;filename=a.png", "https://example.com"})
+	assert.ErrorContains(t, err, "unsupported curl form option")
+
+	// The password prompt can't be part of a printed command.
+	r, err = parseCurl([]string{"curl", "-u", "alice", "https://example.com"})
+	assert.NoError(t, err)
+	_, err = r.Command()
+	assert.ErrorContains(t, err, "password of alice")
+}
+
+func TestFromCurl(t *testing.T) {
+	defer gock.Off()
+
+	gock.New("http://curl.example.com").
+		Post("/items").
+		MatchHeader("X-Test", "yes").
+		MatchHeader("Content-Type", "application/json").
+		JSON(map[string]any{"name": "foo", "count": 2}).
+		Reply(201).
+		JSON(map[string]any{"id": 1})
+
+	captured := run(`from-curl -- curl -X POST http://curl.example.com/items -H X-Test:yes -d {"name":"foo","count":2}`)
+	assert.Contains(t, captured, "HTTP/1.1 201 Created")
+	assert.Contains(t, captured, "id: 1")
+
+	// Auth and TLS options only apply to the imported request.
+	gock.New("http://curl.example.com").
+		Get("/private").
+		MatchHeader("Authorization", "Basic YWxpY2U6c2VjcmV0").
+		Reply(200).
+		JSON(map[string]any{"ok": true})
+
+	captured = run(`from-curl -- curl -k -u alice:secret http://curl.example.com/private`)
+	assert.Contains(t, captured, "ok: true")
+	assert.False(t, viper.GetBool("rsh-insecure"))
+
+	captured = run(`from-curl --rsh-print -- curl -k https://curl.example.com/`)
+	assert.Equal(t, "restish get 'https://curl.example.com/' --rsh-insecure\n", captured)
+
+	// A single argument is split like a shell would, e.g. when pasted.
+	capture := &strings.Builder{}
+	Stdout = capture
+	fromCurl([]string{"curl 'https://curl.example.com/items' \\\n  -H 'X-Test: yes'"}, true)
+	assert.Equal(t, "restish get 'https://curl.example.com/items' -H 'X-Test:yes'\n", capture.String())
+}
@@ -0,0 +1,353 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+	"github.com/schollz/progressbar/v3"
+	"github.com/spf13/viper"
+)
+
+// downloadMeta is saved next to a partial download so that it can be safely
+// resumed later using `If-Range`. When downloading into a directory, the
+// partial download is named after the URL and the final filename, e.g. from
+// the `Content-Disposition` header, is saved so a later run can find both.
+type downloadMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Filename     string `json:"filename,omitempty"`
+}
+
+// validator returns the value to send in an `If-Range` header, if any. Only
+// strong ETags can be used.
+func (m *downloadMeta) validator() string {
+	if m.ETag != "" && !strings.HasPrefix(m.ETag, "W/") {
+		return m.ETag
+	}
+	return m.LastModified
+}
+
+// safeFilename returns the base name of a path, or an empty string if it
+// can't be used as a filename.
+func safeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+	return name
+}
+
+// downloadFilename returns the filename to use for a download, preferring the
+// `Content-Disposition` header if present.
+func downloadFilename(u *url.URL, header http.Header) string {
+	if header != nil {
+		if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+			if name := safeFilename(params["filename"]); name != "" {
+				return name
+			}
+		}
+	}
+
+	if name := safeFilename(u.Path); name != "" {
+		return name
+	}
+
+	return "download"
+}
+
+// parseContentRange returns the start offset and total size from a
+// `Content-Range` header like `bytes 100-199/200`. The total is -1 if unknown.
+func parseContentRange(value string) (int64, int64, error) {
+	var start, end int64
+	var total string
+	if _, err := fmt.Sscanf(value, "bytes %d-%d/%s", &start, &end, &total); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+
+	if total == "*" {
+		return start, -1, nil
+	}
+
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", value)
+	}
+
+	return start, size, nil
+}
+
+// verifyDigest checks a file from the given offset against a structured
+// `Content-Digest` or `Repr-Digest` header value like `sha-256=:base64:`.
+// Unsupported algorithms are ignored.
+func verifyDigest(value string, filename string, offset int64) error {
+	for _, item := range strings.Split(value, ",") {
+		alg, encoded, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok {
+			continue
+		}
+
+		var h hash.Hash
+		switch strings.ToLower(alg) {
+		case "sha-256":
+			h = sha256.New()
+		case "sha-512":
+			h = sha512.New()
+		default:
+			continue
+		}
+
+		expected, err := base64.StdEncoding.DecodeString(strings.Trim(encoded, ":"))
+		if err != nil {
+			return fmt.Errorf("invalid digest %q", item)
+		}
+
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(h, f); err != nil {
+			return err
+		}
+
+		if !bytes.Equal(h.Sum(nil), expected) {
+			return fmt.Errorf("%s digest mismatch", alg)
+		}
+		LogDebug("Verified %s digest", alg)
+		return nil
+	}
+
+	return nil
+}
+
+// Download makes a request and streams the response body to a file rather
+// than into memory. If `output` is a directory, then the filename comes from
+// the `Content-Disposition` header or the URL. Partial downloads are kept in
+// a `.part` file and resumed with `Range` and `If-Range` headers, both when
+// the connection drops and in later runs. Returns the path to the file, or an
+// empty string if the server responded with an error, which is printed.
+func Download(req *http.Request, output string) (string, error) {
+	dir := ""
+	if info, err := os.Stat(output); (err == nil && info.IsDir()) || strings.HasSuffix(output, "/") || strings.HasSuffix(output, string(os.PathSeparator)) {
+		dir = output
+	}
+
+	// Partial downloads always use the same name for a URL, so they can be
+	// found again before the final filename is known.
+	target := output
+	if dir != "" {
+		target = filepath.Join(dir, downloadFilename(req.URL, nil))
+	}
+	partPath := target + ".part"
+	metaPath := partPath + ".json"
+
+	if req.Header.Get("accept-encoding") == "" {
+		// Ranges and digests apply to the bytes as sent, so ask for them as-is.
+		req.Header.Set("accept-encoding", "identity")
+	}
+
+	body, err := readBody(req)
+	if err != nil {
+		return "", err
+	}
+
+	retries := viper.GetInt("rsh-retry")
+	for attempt := 0; ; attempt++ {
+		tryReq := req.Clone(req.Context())
+		if body != nil {
+			tryReq.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		// Resume a previous partial download if it's safe to do so.
+		var offset int64
+		if info, err := os.Stat(partPath); err == nil && info.Size() > 0 {
+			meta := &downloadMeta{}
+			if data, err := os.ReadFile(metaPath); err == nil && json.Unmarshal(data, meta) == nil && meta.URL == req.URL.String() && meta.validator() != "" {
+				offset = info.Size()
+				if dir != "" && safeFilename(meta.Filename) != "" {
+					target = filepath.Join(dir, safeFilename(meta.Filename))
+				}
+				tryReq.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+				tryReq.Header.Set("If-Range", meta.validator())
+				LogInfo("Resuming download of %s at %d bytes", target, offset)
+			}
+		}
+
+		resp, err := MakeRequest(tryReq, WithoutCache())
+		if err != nil {
+			return "", err
+		}
+
+		if resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 {
+			// The partial file can't be used, so start over.
+			resp.Body.Close()
+			os.Remove(partPath)
+			os.Remove(metaPath)
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			parsed, err := ParseResponse(resp)
+			if err != nil {
+				return "", err
+			}
+			if err := Formatter.Format(parsed); err != nil {
+				return "", err
+			}
+			checkExpectations(parsed, true)
+			return "", nil
+		}
+
+		total := resp.ContentLength
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if resp.StatusCode == http.StatusPartialContent && offset > 0 {
+			start, size, err := parseContentRange(resp.Header.Get("Content-Range"))
+			if err != nil {
+				resp.Body.Close()
+				return "", err
+			}
+			if start != offset {
+				resp.Body.Close()
+				return "", fmt.Errorf("server resumed download at byte %d instead of %d", start, offset)
+			}
+			total = size
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		} else {
+			// The full content was sent, e.g. because it has changed since the
+			// partial download, so use its name and start over.
+			offset = 0
+			if dir != "" {
+				target = filepath.Join(dir, downloadFilename(req.URL, resp.Header))
+			}
+		}
+
+		meta := &downloadMeta{
+			URL:          req.URL.String(),
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		}
+		if dir != "" {
+			meta.Filename = filepath.Base(target)
+		}
+		if data, err := json.Marshal(meta); err == nil {
+			os.WriteFile(metaPath, data, 0600)
+		}
+
+		f, err := os.OpenFile(partPath, flags, 0600)
+		if err != nil {
+			resp.Body.Close()
+			return "", err
+		}
+
+		bar := progressbar.NewOptions64(total,
+			progressbar.OptionSetWriter(Stderr),
+			progressbar.OptionSetDescription(filepath.Base(target)),
+			progressbar.OptionShowBytes(true),
+			progressbar.OptionSetVisibility(isTerminal(Stderr)),
+			progressbar.OptionClearOnFinish(),
+		)
+		bar.Set64(offset)
+
+		_, err = io.Copy(io.MultiWriter(f, bar), resp.Body)
+		resp.Body.Close()
+		f.Close()
+		bar.Finish()
+
+		if err != nil {
+			if attempt < retries && meta.validator() != "" {
+				LogWarning("Download interrupted: %v, resuming", err)
+				continue
+			}
+			return "", fmt.Errorf("download interrupted, run again to resume: %w", err)
+		}
+
+		if err := verifyDownload(partPath, offset, total, resp.Header); err != nil {
+			// The partial file is corrupt, so don't resume it.
+			os.Remove(partPath)
+			os.Remove(metaPath)
+			return "", fmt.Errorf("download of %s failed verification: %w", target, err)
+		}
+
+		if err := os.Rename(partPath, target); err != nil {
+			return "", err
+		}
+		os.Remove(metaPath)
+
+		// The body was saved to disk rather than parsed, so only the status and
+		// headers can be checked.
+		checkExpectations(Response{
+			Proto:   resp.Proto,
+			Status:  resp.StatusCode,
+			Headers: joinHeaders(resp.Header),
+		}, false)
+
+		return target, nil
+	}
+}
+
+// verifyDownload checks the size and digests of a completed download. The
+// offset is where the last response started, which is needed to check a
+// `Content-Digest` of partial content.
+func verifyDownload(filename string, offset, total int64, header http.Header) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+
+	if total >= 0 && info.Size() != total {
+		return fmt.Errorf("expected %d bytes but got %d", total, info.Size())
+	}
+
+	if v := header.Get("Repr-Digest"); v != "" {
+		if err := verifyDigest(v, filename, 0); err != nil {
+			return err
+		}
+	}
+
+	if v := header.Get("Content-Digest"); v != "" {
+		if err := verifyDigest(v, filename, offset); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MakeRequestAndDownload makes a request and saves the response body to a
+// file, printing where it was saved.
+func MakeRequestAndDownload(req *http.Request, output string) {
+	filename, err := Download(req, output)
+	if err != nil {
+		panic(err)
+	}
+
+	if filename != "" {
+		LogInfo("Saved %s", filename)
+	}
+}
+
+// isTerminal returns whether a writer is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(interface{ Fd() uintptr })
+	return ok && (isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd()))
+}
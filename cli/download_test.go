@@ -0,0 +1,170 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+var downloadContent = bytes.Repeat([]byte("0123456789"), 1000)
+
+func downloadServer(interrupt *atomic.Bool) *httptest.Server {
+	sum := sha256.Sum256(downloadContent)
+	digest := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case "/bad-digest":
+			w.Header().Set("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(make([]byte, 32))+":")
+		default:
+			w.Header().Set("Repr-Digest", digest)
+		}
+
+		w.Header().Set("Content-Disposition", `attachment; filename="../report.txt"`)
+		if interrupt != nil && interrupt.CompareAndSwap(true, false) {
+			// Send only part of the body, then drop the connection.
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Length", strconv.Itoa(len(downloadContent)))
+			w.Write(downloadContent[:len(downloadContent)/2])
+			return
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(downloadContent))
+	}))
+}
+
+func TestDownload(t *testing.T) {
+	gock.Off()
+	reset(false)
+
+	server := downloadServer(nil)
+	defer server.Close()
+	dir := t.TempDir()
+
+	// The filename comes from the Content-Disposition header.
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/files/abc", nil)
+	filename, err := Download(req, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "report.txt"), filename)
+	data, _ := os.ReadFile(filename)
+	assert.Equal(t, downloadContent, data)
+
+	// Resume a partial download from a previous run.
+	target := filepath.Join(dir, "resumed.txt")
+	os.WriteFile(target+".part", downloadContent[:1234], 0600)
+	os.WriteFile(target+".part.json", []byte(`{"url": "`+server.URL+`/files/abc", "etag": "\"v1\""}`), 0600)
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/files/abc", nil)
+	filename, err = Download(req, target)
+	assert.NoError(t, err)
+	assert.Equal(t, target, filename)
+	data, _ = os.ReadFile(target)
+	assert.Equal(t, downloadContent, data)
+	assert.NoFileExists(t, target+".part")
+	assert.NoFileExists(t, target+".part.json")
+
+	// A partial download of a different version is replaced.
+	os.WriteFile(target+".part", []byte("old"), 0600)
+	os.WriteFile(target+".part.json", []byte(`{"url": "`+server.URL+`/files/abc", "etag": "\"v0\""}`), 0600)
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/files/abc", nil)
+	_, err = Download(req, target)
+	assert.NoError(t, err)
+	data, _ = os.ReadFile(target)
+	assert.Equal(t, downloadContent, data)
+
+	// Digest mismatches are errors.
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/bad-digest", nil)
+	_, err = Download(req, filepath.Join(dir, "bad.txt"))
+	assert.ErrorContains(t, err, "digest mismatch")
+	assert.NoFileExists(t, filepath.Join(dir, "bad.txt"))
+	assert.NoFileExists(t, filepath.Join(dir, "bad.txt.part"))
+}
+
+func TestDownloadInterrupted(t *testing.T) {
+	gock.Off()
+	reset(false)
+	viper.Set("rsh-retry", 1)
+
+	interrupt := &atomic.Bool{}
+	interrupt.Store(true)
+	server := downloadServer(interrupt)
+	defer server.Close()
+
+	target := filepath.Join(t.TempDir(), "file.txt")
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/file.txt", nil)
+	_, err := Download(req, target)
+	assert.NoError(t, err)
+	data, _ := os.ReadFile(target)
+	assert.Equal(t, downloadContent, data)
+}
+
+func TestDownloadResumeDirectory(t *testing.T) {
+	gock.Off()
+	reset(false)
+
+	interrupt := &atomic.Bool{}
+	interrupt.Store(true)
+	server := downloadServer(interrupt)
+	defer server.Close()
+
+	ranges := []string{}
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		handler.ServeHTTP(w, r)
+	})
+	dir := t.TempDir()
+
+	// The partial download is named after the URL until it is complete.
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/files/abc", nil)
+	_, err := Download(req, dir)
+	assert.ErrorContains(t, err, "run again to resume")
+	assert.FileExists(t, filepath.Join(dir, "abc.part"))
+	assert.NoFileExists(t, filepath.Join(dir, "report.txt"))
+
+	// A later run resumes it and saves it using the Content-Disposition name.
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/files/abc", nil)
+	filename, err := Download(req, dir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "report.txt"), filename)
+	data, _ := os.ReadFile(filename)
+	assert.Equal(t, downloadContent, data)
+	assert.Equal(t, []string{"", "bytes=" + strconv.Itoa(len(downloadContent)/2) + "-"}, ranges)
+	assert.NoFileExists(t, filepath.Join(dir, "abc.part"))
+	assert.NoFileExists(t, filepath.Join(dir, "abc.part.json"))
+}
+
+func TestDownloadCommand(t *testing.T) {
+	gock.Off()
+
+	server := downloadServer(nil)
+	defer server.Close()
+	dir := t.TempDir()
+
+	run("download " + server.URL + "/files/abc " + dir + "/")
+	assert.FileExists(t, filepath.Join(dir, "report.txt"))
+
+	run("get " + server.URL + "/files/abc -O " + filepath.Join(dir, "other.txt"))
+	assert.FileExists(t, filepath.Join(dir, "other.txt"))
+
+	// Errors are shown rather than saved.
+	captured := run("download " + server.URL + "/missing " + dir)
+	assert.Contains(t, captured, "404 Not Found")
+}
@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/quick"
+	"github.com/spf13/viper"
+)
+
+// ErrDryRun is returned by `MakeRequest` in dry run or export mode after the
+// request has been printed instead of sent.
+var ErrDryRun = errors.New("request not sent in dry run mode")
+
+// RequestPreview describes a fully-built request which has not been sent.
+type RequestPreview struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Body    any               `json:"body,omitempty"`
+	header  http.Header
+	raw     []byte
+}
+
+// previewRequest captures a request as it would be sent by the given client,
+// including cookies from its jar. Any content encoding is removed from the
+// body so that it is readable. If `unsafe` is not set, then secrets like auth
+// headers, passwords, and query params like `api_key` are redacted. The request body is consumed.
+func previewRequest(client *http.Client, req *http.Request, unsafe bool) (*RequestPreview, error) {
+	header := req.Header.Clone()
+	if req.Host != "" {
+		header.Set("Host", req.Host)
+	} else {
+		header.Set("Host", req.URL.Host)
+	}
+
+	if client != nil && client.Jar != nil && header.Get("Cookie") == "" {
+		cookies := []string{}
+		for _, c := range client.Jar.Cookies(req.URL) {
+			cookies = append(cookies, c.Name+"="+c.Value)
+		}
+		if len(cookies) > 0 {
+			header.Set("Cookie", strings.Join(cookies, "; "))
+		}
+	}
+
+	var raw []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		decoded, err := decodeBody(header, req.Body, nil)
+		if err != nil {
+			return nil, err
+		}
+		if raw, err = io.ReadAll(decoded); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+
+	u := req.URL.String()
+	if !unsafe {
+		// Query params like `api_key` are redacted the same way as in HAR files.
+		_, u = (&harRecorder{}).query(req.URL)
+		for name := range header {
+			if harSensitiveHeaders[http.CanonicalHeaderKey(name)] {
+				header.Set(name, harRedacted)
+			}
+		}
+		raw = redactBody(header.Get("Content-Type"), raw)
+	}
+
+	preview := &RequestPreview{
+		Method:  req.Method,
+		URL:     u,
+		Headers: joinHeaders(header),
+		header:  header,
+		raw:     raw,
+	}
+
+	if len(raw) > 0 {
+		var body any
+		if err := Unmarshal(header.Get("Content-Type"), raw, &body); err == nil {
+			preview.Body = body
+		} else if utf8.Valid(raw) {
+			preview.Body = string(raw)
+		} else {
+			preview.Body = raw
+		}
+	}
+
+	return preview, nil
+}
+
+// Wire returns the request in HTTP/1.1 wire format with sorted headers.
+func (p *RequestPreview) Wire() []byte {
+	u := p.URL
+	if parsed, err := url.Parse(p.URL); err == nil {
+		u = parsed.RequestURI()
+	}
+
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "%s %s HTTP/1.1\r\n", p.Method, u)
+
+	names := make([]string, 0, len(p.header))
+	for name := range p.header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, v := range p.header[name] {
+			fmt.Fprintf(buf, "%s: %s\r\n", name, v)
+		}
+	}
+	buf.WriteString("\r\n")
+	buf.Write(p.raw)
+
+	return buf.Bytes()
+}
+
+// printDryRun writes a request preview to stdout in HTTP wire format, or as
+// structured data if an output format like `json` is selected.
+func printDryRun(preview *RequestPreview) {
+	if viper.GetString("rsh-output-format") != "auto" {
+		printStructured(preview)
+		return
+	}
+
+	wire := preview.Wire()
+	if useColor && utf8.Valid(wire) {
+		sb := &strings.Builder{}
+		if err := quick.Highlight(sb, string(wire), "http", "terminal256", "cli-dark"); err == nil {
+			wire = []byte(sb.String())
+		}
+	}
+
+	Stdout.Write(wire)
+	if len(wire) > 0 && wire[len(wire)-1] != '\n' {
+		Stdout.Write([]byte("\n"))
+	}
+}
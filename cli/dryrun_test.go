@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestDryRun(t *testing.T) {
+	defer gock.Off()
+
+	// Don't leave dry run mode enabled for other tests.
+	defer reset(false)
+
+	reset(false)
+	configs["dry-test"] = &APIConfig{
+		name:         "dry-test",
+		Base:         "http://dry.example.com",
+		CompressBody: "gzip",
+		Profiles: map[string]*APIProfile{
+			"default": {
+				Headers: map[string]string{"X-Tenant": "acme"},
+				Query:   map[string]string{"region": "eu", "api_key": "abc123"},
+				Auth: &APIAuth{
+					Name:   "http-basic",
+					Params: map[string]string{"username": "alice", "password": "secret"},
+				},
+			},
+		},
+	}
+	defer delete(configs, "dry-test")
+
+	// No mocks are registered, so any request sent would fail.
+	captured := runNoReset("post dry-test/items --rsh-dry-run name: foo, password: hunter2")
+	assert.Contains(t, captured, "POST /items?api_key=REDACTED&region=eu HTTP/1.1\r\n")
+	assert.NotContains(t, captured, "abc123")
+	assert.Contains(t, captured, "Host: dry.example.com\r\n")
+	assert.Contains(t, captured, "X-Tenant: acme\r\n")
+	assert.Contains(t, captured, "Authorization: REDACTED\r\n")
+	assert.Contains(t, captured, "Content-Encoding: gzip\r\n")
+	assert.Contains(t, captured, `"password":"REDACTED"`)
+	assert.NotContains(t, captured, "ERROR")
+
+	captured = runNoReset("post dry-test/items --rsh-dry-run --rsh-dry-run-unsafe -o json name: foo, password: hunter2")
+	preview := RequestPreview{}
+	assert.NoError(t, json.Unmarshal([]byte(captured), &preview))
+	assert.Equal(t, "POST", preview.Method)
+	assert.Equal(t, "http://dry.example.com/items?api_key=abc123&region=eu", preview.URL)
+	assert.Equal(t, "Basic YWxpY2U6c2VjcmV0", preview.Headers["Authorization"])
+	assert.Equal(t, map[string]any{"name": "foo", "password": "hunter2"}, preview.Body)
+}
@@ -41,6 +41,15 @@ func edit(addr string, args []string, interactive, noPrompt bool, exitFunc func(
 		return
 	}
 
+	// Submit as JSON unless another format is given via the `Content-Type`
+	// header, e.g. `-H Content-Type:application/cbor`.
+	mediaType := bodyMediaType("application/json")
+	if isFormMediaType(mediaType) {
+		fmt.Fprintf(os.Stderr, "Editing resources as %s is not supported.\n", mediaType)
+		exitFunc(1)
+		return
+	}
+
 	editor := getEditor()
 	if interactive && editor == "" {
 		fmt.Fprintln(os.Stderr, `Please set the VISUAL or EDITOR environment variable with your preferred editor. Examples:
@@ -172,13 +181,12 @@ export EDITOR="vim"`)
 		}
 	}
 
-	// TODO: support different submission formats, e.g. based on any given
-	// `Content-Type` header?
 	// TODO: content-encoding for large bodies?
 	// TODO: determine if a PATCH could be used instead?
-	b, _ := json.Marshal(modified)
+	b, err := Marshal(mediaType, modified)
+	panicOnErr(err)
 	req, _ = http.NewRequest(http.MethodPut, fixAddress(addr), bytes.NewReader(b))
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", mediaType)
 
 	if etag != "" {
 		req.Header.Set("If-Match", etag)
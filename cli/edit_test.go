@@ -6,6 +6,8 @@ import (
 	"os"
 	"testing"
 
+	"github.com/fxamacker/cbor/v2"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/h2non/gock.v1"
 )
@@ -106,3 +108,45 @@ func TestEditNotObject(t *testing.T) {
 
 	assert.Equal(t, 1, code)
 }
+
+func TestEditContentType(t *testing.T) {
+	defer gock.Off()
+	defer reset(false)
+
+	reset(false)
+	viper.Set("rsh-header", []string{"Content-Type:application/cbor"})
+
+	gock.New("http://example.com").
+		Get("/items/foo").
+		Reply(http.StatusOK).
+		JSON(map[string]any{
+			"foo": 123,
+		})
+
+	gock.New("http://example.com").
+		Put("/items/foo").
+		MatchType("application/cbor").
+		AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+			var body map[string]any
+			err := cbor.NewDecoder(req.Body).Decode(&body)
+			return assert.Equal(t, map[string]any{"foo": 123.0, "bar": uint64(456)}, body), err
+		}).
+		Reply(http.StatusOK)
+
+	edit("http://example.com/items/foo", []string{"bar:456"}, false, true, func(int) {}, json.Marshal, json.Unmarshal, "json")
+	assert.True(t, gock.IsDone())
+}
+
+func TestEditFormContentType(t *testing.T) {
+	defer reset(false)
+
+	reset(false)
+	viper.Set("rsh-header", []string{"Content-Type:application/x-www-form-urlencoded"})
+
+	code := 999
+	edit("http://example.com/items/foo", []string{"bar:456"}, false, true, func(c int) {
+		code = c
+	}, json.Marshal, json.Unmarshal, "json")
+
+	assert.Equal(t, 1, code)
+}
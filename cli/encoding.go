@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"sort"
 	"strings"
 
 	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
 // ContentEncoding is used to encode/decode content for transfer over the wire,
@@ -17,48 +20,196 @@ type ContentEncoding interface {
 	Reader(stream io.Reader) (io.Reader, error)
 }
 
-// contentTypes is a list of acceptable content types
-var encodings = map[string]ContentEncoding{}
+// ContentEncoder describes an optional method that ContentEncodings can
+// implement to encode request bodies. This is optional because only some
+// encodings are useful for uploads.
+type ContentEncoder interface {
+	Writer(w io.Writer) (io.WriteCloser, error)
+}
+
+type encodingEntry struct {
+	q        float32
+	encoding ContentEncoding
+}
+
+// encodings is a list of acceptable content encodings
+var encodings = map[string]encodingEntry{}
 
-// AddEncoding adds a new content encoding with the given name.
+// AddEncoding adds a new content encoding with the given name and a q factor
+// of 1.0.
 func AddEncoding(name string, encoding ContentEncoding) {
-	encodings[name] = encoding
+	AddEncodingWithQ(name, 1.0, encoding)
+}
+
+// AddEncodingWithQ adds a new content encoding with the given name and q
+// factor (0-1.0, higher has priority). Encodings with a q factor of zero are
+// used to decode responses but are not advertised to the server.
+func AddEncodingWithQ(name string, q float32, encoding ContentEncoding) {
+	encodings[strings.ToLower(name)] = encodingEntry{
+		q:        q,
+		encoding: encoding,
+	}
 }
 
 func buildAcceptEncodingHeader() string {
-	accept := []string{}
+	names := []string{}
+	for name, entry := range encodings {
+		if entry.q > 0 {
+			names = append(names, name)
+		}
+	}
+
+	// Sort by preference so the header is stable and easy to read.
+	sort.Slice(names, func(i, j int) bool {
+		qi, qj := encodings[names[i]].q, encodings[names[j]].q
+		if qi != qj {
+			return qi > qj
+		}
+		return names[i] < names[j]
+	})
 
-	for name := range encodings {
-		accept = append(accept, name)
+	accept := []string{}
+	for _, name := range names {
+		if q := encodings[name].q; q < 1 {
+			accept = append(accept, fmt.Sprintf("%s;q=%.3g", name, q))
+		} else {
+			accept = append(accept, name)
+		}
 	}
 
 	return strings.Join(accept, ", ")
 }
 
 // DecodeResponse will replace the response body with a decoding reader if needed.
-// Assumes the original body will be closed outside of this function.
+// Stacked encodings like `gzip, br` are removed in the reverse of the order
+// they were applied. Assumes the original body will be closed outside of this
+// function.
 func DecodeResponse(resp *http.Response) error {
-	contentEncoding := resp.Header.Get("content-encoding")
+	var dict []byte
+	if resp.Request != nil {
+		// Some APIs compress responses using a shared zstd dictionary, which
+		// must also be used to decode them.
+		if _, config := findAPI(resp.Request.URL.String()); config != nil && config.ZstdDict != "" {
+			var err error
+			if dict, err = os.ReadFile(config.ZstdDict); err != nil {
+				return fmt.Errorf("unable to read zstd dictionary: %w", err)
+			}
+		}
+	}
 
-	if contentEncoding == "" {
+	reader, err := decodeBody(resp.Header, resp.Body, dict)
+	if err != nil {
+		return err
+	}
+
+	if reader != resp.Body {
+		resp.Body = io.NopCloser(reader)
+	}
+
+	return nil
+}
+
+// decodeBody returns a reader which removes any content encodings listed in
+// the headers from the body. The optional dictionary is used for zstd.
+func decodeBody(header http.Header, body io.Reader, zstdDict []byte) (io.Reader, error) {
+	contentEncodings := []string{}
+	for _, value := range header.Values("content-encoding") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name != "" && name != "identity" {
+				contentEncodings = append(contentEncodings, name)
+			}
+		}
+	}
+
+	if len(contentEncodings) == 0 {
 		// Nothing to do!
+		return body, nil
+	}
+
+	// Check all the encodings first so the body is left as-is on error.
+	for _, name := range contentEncodings {
+		if _, ok := encodings[name]; !ok {
+			return nil, fmt.Errorf("unsupported content-encoding %s", name)
+		}
+	}
+
+	reader := body
+	for i := len(contentEncodings) - 1; i >= 0; i-- {
+		name := contentEncodings[i]
+		LogDebug("Decoding %s content", name)
+
+		encoding := encodings[name].encoding
+		if _, ok := encoding.(*ZstdEncoding); ok && zstdDict != nil {
+			encoding = &ZstdEncoding{Dicts: [][]byte{zstdDict}}
+		}
+
+		var err error
+		reader, err = encoding.Reader(reader)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return reader, nil
+}
+
+// EncodeRequest replaces the request body with one encoded using the named
+// encoding and sets the content-encoding header. The body is encoded as it is
+// sent rather than up front, so large bodies are never held in memory twice.
+// Requests without a body or which are already encoded are left as-is.
+func EncodeRequest(req *http.Request, name string) error {
+	if req.Body == nil || req.Body == http.NoBody || req.Header.Get("content-encoding") != "" {
 		return nil
 	}
 
-	encoding := encodings[contentEncoding]
+	name = strings.ToLower(name)
+	encoder, ok := encodings[name].encoding.(ContentEncoder)
+	if !ok {
+		return fmt.Errorf("unsupported content-encoding %s for request body", name)
+	}
+
+	LogDebug("Encoding request body with %s", name)
+
+	encode := func(body io.ReadCloser) io.ReadCloser {
+		pr, pw := io.Pipe()
+
+		go func() {
+			defer body.Close()
 
-	if encoding == nil {
-		return fmt.Errorf("unsupported content-encoding %s", contentEncoding)
+			w, err := encoder.Writer(pw)
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+
+			if _, err := io.Copy(w, body); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+
+			pw.CloseWithError(w.Close())
+		}()
+
+		return pr
 	}
 
-	LogDebug("Decoding response from %s", contentEncoding)
+	req.Body = encode(req.Body)
 
-	reader, err := encoding.Reader(resp.Body)
-	if err != nil {
-		return err
+	if getBody := req.GetBody; getBody != nil {
+		// Encode the body again when it is re-created, e.g. for retries.
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := getBody()
+			if err != nil {
+				return nil, err
+			}
+			return encode(body), nil
+		}
 	}
 
-	resp.Body = io.NopCloser(reader)
+	// The encoded length isn't known until the whole body has been encoded.
+	req.ContentLength = -1
+	req.Header.Set("content-encoding", name)
 
 	return nil
 }
@@ -71,6 +222,11 @@ func (g DeflateEncoding) Reader(stream io.Reader) (io.Reader, error) {
 	return flate.NewReader(stream), nil
 }
 
+// Writer returns a new writer that applies the deflate encoding.
+func (g DeflateEncoding) Writer(w io.Writer) (io.WriteCloser, error) {
+	return flate.NewWriter(w, flate.DefaultCompression)
+}
+
 // GzipEncoding supports gzip-encoded response content.
 type GzipEncoding struct{}
 
@@ -79,6 +235,11 @@ func (g GzipEncoding) Reader(stream io.Reader) (io.Reader, error) {
 	return gzip.NewReader(stream)
 }
 
+// Writer returns a new writer that applies the gzip encoding.
+func (g GzipEncoding) Writer(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
 // BrotliEncoding supports RFC 7932 Brotli content encoding.
 type BrotliEncoding struct{}
 
@@ -86,3 +247,36 @@ type BrotliEncoding struct{}
 func (b BrotliEncoding) Reader(stream io.Reader) (io.Reader, error) {
 	return io.Reader(brotli.NewReader(stream)), nil
 }
+
+// Writer returns a new writer that applies the brotli encoding.
+func (b BrotliEncoding) Writer(w io.Writer) (io.WriteCloser, error) {
+	return brotli.NewWriter(w), nil
+}
+
+// ZstdEncoding supports RFC 8878 Zstandard content encoding.
+type ZstdEncoding struct {
+	// Dicts are optional dictionaries used to decode content which was
+	// compressed with a dictionary shared between the client and server.
+	Dicts [][]byte
+}
+
+// Reader returns a new reader for the stream that removes the zstd encoding.
+func (z ZstdEncoding) Reader(stream io.Reader) (io.Reader, error) {
+	// A single goroutine is enough for a response body and means nothing is
+	// left running once the stream has been read.
+	options := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+	if len(z.Dicts) > 0 {
+		options = append(options, zstd.WithDecoderDicts(z.Dicts...))
+	}
+
+	d, err := zstd.NewReader(stream, options...)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// Writer returns a new writer that applies the zstd encoding.
+func (z ZstdEncoding) Writer(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
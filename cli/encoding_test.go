@@ -4,12 +4,20 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
 )
 
 func gzipEnc(data string) []byte {
@@ -36,6 +44,14 @@ func brEnc(data string) []byte {
 	return b.Bytes()
 }
 
+func zstdEnc(data string) []byte {
+	b := bytes.NewBuffer(nil)
+	w, _ := zstd.NewWriter(b)
+	w.Write([]byte(data))
+	w.Close()
+	return b.Bytes()
+}
+
 var encodingTests = []struct {
 	name   string
 	header string
@@ -45,6 +61,7 @@ var encodingTests = []struct {
 	{"gzip", "gzip", gzipEnc("hello world")},
 	{"deflate", "deflate", deflateEnc("hello world")},
 	{"brotli", "br", brEnc("hello world")},
+	{"zstd", "zstd", zstdEnc("hello world")},
 }
 
 func TestEncodings(parent *testing.T) {
@@ -66,3 +83,166 @@ func TestEncodings(parent *testing.T) {
 		})
 	}
 }
+
+func TestStackedEncodings(t *testing.T) {
+	reset(false)
+
+	// Gzip was applied first, then brotli, so they must be removed in reverse.
+	b := bytes.NewBuffer(nil)
+	w := brotli.NewWriter(b)
+	w.Write(gzipEnc("hello world"))
+	w.Close()
+
+	resp := &http.Response{
+		Header: http.Header{
+			"Content-Encoding": []string{"GZIP, identity, br"},
+		},
+		Body: io.NopCloser(b),
+	}
+
+	assert.NoError(t, DecodeResponse(resp))
+	data, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	resp.Header.Set("Content-Encoding", "gzip, unknown")
+	assert.ErrorContains(t, DecodeResponse(resp), "unsupported content-encoding unknown")
+}
+
+func TestAcceptEncodingHeader(t *testing.T) {
+	reset(false)
+	assert.Equal(t, "zstd, br;q=0.9, gzip;q=0.8, deflate;q=0.5", buildAcceptEncodingHeader())
+
+	// Encodings with a zero q factor are only used to decode.
+	AddEncodingWithQ("custom", 0, &GzipEncoding{})
+	assert.Equal(t, "zstd, br;q=0.9, gzip;q=0.8, deflate;q=0.5", buildAcceptEncodingHeader())
+}
+
+func TestEncodeRequest(t *testing.T) {
+	reset(false)
+
+	for _, tt := range encodingTests[1:] {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("hello world"))
+			assert.NoError(t, EncodeRequest(req, tt.header))
+			assert.Equal(t, tt.header, req.Header.Get("Content-Encoding"))
+			assert.Equal(t, int64(-1), req.ContentLength)
+
+			// The encoded body must round-trip, including when re-created.
+			again, err := req.GetBody()
+			assert.NoError(t, err)
+
+			for _, body := range []io.ReadCloser{req.Body, again} {
+				resp := &http.Response{
+					Header: http.Header{"Content-Encoding": []string{tt.header}},
+					Body:   body,
+				}
+				assert.NoError(t, DecodeResponse(resp))
+				data, err := io.ReadAll(resp.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, "hello world", string(data))
+			}
+		})
+	}
+
+	// Bodies which are already encoded are left alone.
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("hello world"))
+	req.Header.Set("Content-Encoding", "custom")
+	assert.NoError(t, EncodeRequest(req, "gzip"))
+	assert.Equal(t, "custom", req.Header.Get("Content-Encoding"))
+
+	// Unknown encodings can't be used.
+	req, _ = http.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("hello world"))
+	assert.Error(t, EncodeRequest(req, "bad"))
+}
+
+func TestCompressBody(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	configs["compressed"] = &APIConfig{
+		name:         "compressed",
+		Base:         "http://compressed.example.com",
+		CompressBody: "br",
+	}
+
+	gock.New("http://compressed.example.com").
+		Post("/items").
+		MatchHeader("Content-Encoding", "br").
+		Reply(http.StatusNoContent)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://compressed.example.com/items", strings.NewReader(`{"foo": 1}`))
+	_, err := MakeRequest(req)
+	assert.NoError(t, err)
+	assert.True(t, gock.IsDone())
+
+	// The CLI flag takes precedence over the API config.
+	viper.Set("rsh-compress-body", "gzip")
+	defer viper.Set("rsh-compress-body", "")
+
+	gock.New("http://compressed.example.com").
+		Post("/items").
+		MatchHeader("Content-Encoding", "gzip").
+		Reply(http.StatusNoContent)
+
+	req, _ = http.NewRequest(http.MethodPost, "http://compressed.example.com/items", strings.NewReader(`{"foo": 1}`))
+	_, err = MakeRequest(req)
+	assert.NoError(t, err)
+	assert.True(t, gock.IsDone())
+}
+
+func TestZstdDictionary(t *testing.T) {
+	reset(false)
+
+	samples := [][]byte{}
+	for i := 0; i < 100; i++ {
+		samples = append(samples, []byte(fmt.Sprintf(`{"id": %d, "name": "example %d", "tags": ["one", "two"], "created": "2024-01-%02d"}`, i, i*7, i%28+1)))
+	}
+	sample := samples[42]
+
+	dict, err := zstd.BuildDict(zstd.BuildDictOptions{
+		ID:       1234,
+		Contents: samples,
+		History:  bytes.Join(samples[:10], nil),
+		Offsets:  [3]int{1, 4, 8},
+	})
+	require.NoError(t, err)
+
+	b := bytes.NewBuffer(nil)
+	w, _ := zstd.NewWriter(b, zstd.WithEncoderDict(dict))
+	w.Write(sample)
+	w.Close()
+
+	makeResponse := func() *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, "https://zstd.example.com/items", nil)
+		return &http.Response{
+			Header: http.Header{
+				"Content-Encoding": []string{"zstd"},
+			},
+			Body:    io.NopCloser(bytes.NewReader(b.Bytes())),
+			Request: req,
+		}
+	}
+
+	// Without the dictionary the response can't be decoded.
+	resp := makeResponse()
+	require.NoError(t, DecodeResponse(resp))
+	_, err = io.ReadAll(resp.Body)
+	assert.Error(t, err)
+
+	dictPath := filepath.Join(t.TempDir(), "dict")
+	require.NoError(t, os.WriteFile(dictPath, dict, 0600))
+
+	defer delete(configs, "zstd-dict")
+	configs["zstd-dict"] = &APIConfig{
+		name:     "zstd-dict",
+		Base:     "https://zstd.example.com",
+		ZstdDict: dictPath,
+	}
+
+	resp = makeResponse()
+	require.NoError(t, DecodeResponse(resp))
+	data, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, sample, data)
+}
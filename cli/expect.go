@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/danielgtaylor/mexpr"
+	"github.com/spf13/viper"
+)
+
+// ExitCodeExpectationFailed is the exit code used when an expectation does
+// not pass. It is distinct from the exit codes based on the HTTP status.
+const ExitCodeExpectationFailed = 2
+
+// expectationFailed is set once any expectation has not passed.
+var expectationFailed bool
+
+// expectationsChecked is set once expectations have been evaluated, at which
+// point they decide the exit code rather than the HTTP status. Commands which
+// never evaluate them, like `batch`, keep the status-based exit code.
+var expectationsChecked bool
+
+// expectHeaderPattern matches header references within an expression, e.g.
+// `headers.Content-Type`, which mexpr would otherwise parse as a subtraction.
+var expectHeaderPattern = regexp.MustCompile(`(^|[^\w.])headers\.([\w-]+)`)
+
+// expectHeaderKey returns the key used for a header when evaluating
+// expectations. Header names are case-insensitive so they are canonicalized,
+// and dashes become underscores so they are valid mexpr identifiers.
+func expectHeaderKey(name string) string {
+	return strings.ReplaceAll(http.CanonicalHeaderKey(strings.ReplaceAll(name, "_", "-")), "-", "_")
+}
+
+// expectInput returns the response map to evaluate expectations against.
+func expectInput(resp Response) map[string]any {
+	input := resp.Map()
+
+	headers := map[string]any{}
+	for k, v := range resp.Headers {
+		headers[expectHeaderKey(k)] = v
+	}
+	input["headers"] = headers
+
+	return input
+}
+
+// ExpectationError describes an expectation which did not pass, along with
+// the offending value.
+type ExpectationError struct {
+	Expression string
+	Path       string
+	Value      any
+}
+
+func (e *ExpectationError) Error() string {
+	return fmt.Sprintf("expected %s, but %s is %s", e.Expression, e.Path, formatExpectValue(e.Value))
+}
+
+// formatExpectValue returns a short human-readable representation of a value.
+func formatExpectValue(v any) string {
+	if v == nil {
+		return "null"
+	}
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	if encoded, err := MarshalShort("json", false, v); err == nil {
+		return strings.TrimSpace(string(encoded))
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// nodeSpan returns the start and end offsets of the source of a node and all
+// its children within the expression. Only identifiers and literals have
+// reliable lengths, so operators are spanned using their operands.
+func nodeSpan(n *mexpr.Node) (int, int) {
+	if n.Type == mexpr.NodeIdentifier || n.Type == mexpr.NodeLiteral {
+		return int(n.Offset), int(n.Offset) + int(n.Length)
+	}
+
+	start, end := int(n.Offset), int(n.Offset)
+	for _, child := range []*mexpr.Node{n.Left, n.Right} {
+		if child != nil {
+			s, e := nodeSpan(child)
+			start = min(start, s)
+			end = max(end, e)
+		}
+	}
+	if n.Type == mexpr.NodeArrayIndex || n.Type == mexpr.NodeSlice {
+		// Include the closing bracket.
+		end++
+	}
+	return start, end
+}
+
+// offendingNode returns the node whose value best explains why an expression
+// evaluated to false. For comparisons this is the left side, e.g. `status`
+// in `status == 200`, and for `and` it is whichever side failed.
+func offendingNode(ast *mexpr.Node, input map[string]any) *mexpr.Node {
+	switch ast.Type {
+	case mexpr.NodeAnd:
+		if result, err := mexpr.NewInterpreter(ast.Left, mexpr.UnquotedStrings).Run(input); err == nil && (result == nil || IsFalsey(result)) {
+			return offendingNode(ast.Left, input)
+		}
+		return offendingNode(ast.Right, input)
+	case mexpr.NodeEqual, mexpr.NodeNotEqual, mexpr.NodeLessThan,
+		mexpr.NodeLessThanEqual, mexpr.NodeGreaterThan, mexpr.NodeGreaterThanEqual,
+		mexpr.NodeIn, mexpr.NodeContains, mexpr.NodeStartsWith, mexpr.NodeEndsWith,
+		mexpr.NodeBefore, mexpr.NodeAfter:
+		return ast.Left
+	}
+	return ast
+}
+
+// rewriteExpectHeaders rewrites header references in an expression so they
+// match the keys from `expectHeaderKey`. This keeps the expression the same
+// length, so node offsets still point into the original expression.
+func rewriteExpectHeaders(expression string) string {
+	return expectHeaderPattern.ReplaceAllStringFunc(expression, func(match string) string {
+		parts := expectHeaderPattern.FindStringSubmatch(match)
+		return parts[1] + "headers." + expectHeaderKey(parts[2])
+	})
+}
+
+// usesBody returns whether an expression node refers to the response body.
+// The right side of a field selection is a field name rather than a variable,
+// e.g. `headers.body`.
+func usesBody(n *mexpr.Node) bool {
+	if n == nil {
+		return false
+	}
+	switch n.Type {
+	case mexpr.NodeIdentifier:
+		return n.Value == "body"
+	case mexpr.NodeFieldSelect:
+		return usesBody(n.Left)
+	}
+	return usesBody(n.Left) || usesBody(n.Right)
+}
+
+// checkExpectation evaluates an mexpr expression against the response map
+// from `expectInput`. Returns an `*ExpectationError` if the result is falsey,
+// or another error if the expression is invalid.
+func checkExpectation(expression string, input map[string]any) error {
+	ast, err := mexpr.Parse(rewriteExpectHeaders(expression), nil, mexpr.UnquotedStrings)
+	if err != nil {
+		return fmt.Errorf("invalid expression %s\n%s", expression, err.Pretty(expression))
+	}
+	if ast == nil {
+		return fmt.Errorf("invalid expression %s", expression)
+	}
+
+	result, err := mexpr.NewInterpreter(ast, mexpr.UnquotedStrings).Run(input)
+	if err != nil {
+		return fmt.Errorf("unable to evaluate %s\n%s", expression, err.Pretty(expression))
+	}
+	if result != nil && !IsFalsey(result) {
+		return nil
+	}
+
+	node := offendingNode(ast, input)
+	value, _ := mexpr.NewInterpreter(node, mexpr.UnquotedStrings).Run(input)
+	start, end := nodeSpan(node)
+	start = max(start, 0)
+	end = min(end, len(expression))
+
+	return &ExpectationError{
+		Expression: expression,
+		Path:       strings.TrimSpace(expression[start:end]),
+		Value:      value,
+	}
+}
+
+// checkExpectations evaluates each `--rsh-expect` expression against the
+// response, logging the expression and offending value for any which fail.
+// If `hasBody` is false, e.g. for streamed or downloaded responses whose body
+// is never held in memory, expressions using the body are skipped with a
+// warning since they can't be checked.
+func checkExpectations(resp Response, hasBody bool) {
+	expressions := viper.GetStringSlice("rsh-expect")
+	if len(expressions) == 0 {
+		return
+	}
+
+	input := expectInput(resp)
+	for _, expression := range expressions {
+		if !hasBody {
+			ast, err := mexpr.Parse(rewriteExpectHeaders(expression), nil, mexpr.UnquotedStrings)
+			if err == nil && usesBody(ast) {
+				LogWarning("Skipping expectation %s, the body of streamed or downloaded responses can't be checked", expression)
+				continue
+			}
+		}
+
+		expectationsChecked = true
+		if err := checkExpectation(expression, input); err != nil {
+			LogError("%v", err)
+			expectationFailed = true
+		}
+	}
+}
+
+// IsFalsey returns if a value is falsey, such as `0`, `""`, `[]any{}`, etc.
+// Empty slices and maps are considered falsey. Note that `nil` is not, so
+// callers which treat missing values as false must check for it themselves.
+func IsFalsey(v any) bool {
+	switch t := v.(type) {
+	case bool:
+		return !t
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return reflect.ValueOf(t).IsZero()
+	case string:
+		return len(t) == 0
+	case []byte:
+		return len(t) == 0
+	case []any:
+		return len(t) == 0
+	case map[string]any:
+		return len(t) == 0
+	case map[any]any:
+		return len(t) == 0
+	}
+	return false
+}
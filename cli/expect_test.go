@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"net/http"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestCheckExpectation(t *testing.T) {
+	input := expectInput(Response{
+		Status:  404,
+		Headers: map[string]string{"Content-Type": "application/json", "X-Request-Id": "abc"},
+		Body: map[string]any{
+			"items": []any{},
+			"name":  "test",
+			"tags":  []any{"b"},
+		},
+	})
+
+	for _, expr := range []string{
+		"status == 404",
+		"headers.Content-Type contains json",
+		"headers.content-type startsWith application",
+		"headers.X-Request-ID == abc",
+		"body.name == test and status >= 400",
+	} {
+		assert.NoError(t, checkExpectation(expr, input), expr)
+	}
+
+	for expr, message := range map[string]string{
+		"status == 200":                      "expected status == 200, but status is 404",
+		"body.items.length > 0":              "expected body.items.length > 0, but body.items.length is 0",
+		"headers.Content-Type contains xml":  `expected headers.Content-Type contains xml, but headers.Content-Type is "application/json"`,
+		"body.name == test and status < 300": "expected body.name == test and status < 300, but status is 404",
+		"body.missing":                       "expected body.missing, but body.missing is null",
+	} {
+		err := checkExpectation(expr, input)
+		assert.IsType(t, &ExpectationError{}, err, expr)
+		assert.EqualError(t, err, message)
+	}
+
+	err := checkExpectation("status ==", input)
+	assert.ErrorContains(t, err, "invalid expression")
+}
+
+func TestExpectFlag(t *testing.T) {
+	defer gock.Off()
+	defer reset(false)
+
+	gock.New("http://expect.example.com").
+		Get("/items").
+		Times(3).
+		Reply(http.StatusNotFound).
+		JSON(map[string]any{"items": []any{}})
+
+	// Passing expectations decide the exit code instead of the HTTP status.
+	expectationFailed, expectationsChecked = false, false
+	captured := run("get http://expect.example.com/items --rsh-expect status==404")
+	assert.NotContains(t, captured, "ERROR")
+	assert.Equal(t, 0, GetExitCode())
+
+	captured = run("get http://expect.example.com/items --rsh-expect status==404 --rsh-expect body.items.length>0")
+	assert.Contains(t, captured, "expected body.items.length>0, but body.items.length is 0")
+	assert.Equal(t, ExitCodeExpectationFailed, GetExitCode())
+
+	// Invalid expressions also fail.
+	expectationFailed, expectationsChecked = false, false
+	captured = run("get http://expect.example.com/items --rsh-expect status==")
+	assert.Contains(t, captured, "invalid expression status==")
+	assert.Equal(t, ExitCodeExpectationFailed, GetExitCode())
+	expectationFailed, expectationsChecked = false, false
+	lastStatus = 0
+}
+
+func TestExpectFlagStream(t *testing.T) {
+	defer gock.Off()
+	defer reset(false)
+
+	gock.New("http://expect.example.com").
+		Get("/events").
+		Times(2).
+		Reply(http.StatusNotFound).
+		SetHeader("Content-Type", "text/event-stream").
+		BodyString("data: 1\n\n")
+
+	// The body of streamed responses can't be checked, so expectations using
+	// it are skipped rather than failing.
+	expectationFailed, expectationsChecked = false, false
+	captured := run("get http://expect.example.com/events --rsh-expect status==404 --rsh-expect body.data==1")
+	assert.Contains(t, captured, "Skipping expectation body.data==1")
+	assert.NotContains(t, captured, "ERROR")
+	assert.Equal(t, 0, GetExitCode())
+
+	// Without any expectations evaluated the HTTP status decides the exit code.
+	expectationFailed, expectationsChecked = false, false
+	lastStatus = 0
+	run("get http://expect.example.com/events --rsh-expect body.data==2")
+	assert.Equal(t, 4, GetExitCode())
+	lastStatus = 0
+}
+
+func TestExpectFlagDownload(t *testing.T) {
+	gock.Off()
+	defer reset(false)
+
+	server := downloadServer(nil)
+	defer server.Close()
+	dir := t.TempDir()
+
+	// Only the status and headers are available for downloaded responses.
+	expectationFailed, expectationsChecked = false, false
+	captured := run("get " + server.URL + "/files/abc -O " + filepath.Join(dir, "abc.txt") + " --rsh-expect status==200 --rsh-expect headers.Etag!=\"\"")
+	assert.NotContains(t, captured, "ERROR")
+	assert.Equal(t, 0, GetExitCode())
+
+	captured = run("download " + server.URL + "/missing " + dir + " --rsh-expect status==200")
+	assert.Contains(t, captured, "expected status==200, but status is 404")
+	assert.Equal(t, ExitCodeExpectationFailed, GetExitCode())
+	expectationFailed, expectationsChecked = false, false
+	lastStatus = 0
+}
+
+func TestExpectFlagUnsupported(t *testing.T) {
+	gock.Off()
+	defer reset(false)
+
+	server := batchServer(t, &atomic.Int32{}, &atomic.Int32{})
+	filename := writeTestFile(t, "requests.jsonl", `{"name": "missing", "uri": "`+server.URL+`/missing"}`)
+
+	// Commands which don't evaluate expectations keep the HTTP status exit code.
+	expectationFailed, expectationsChecked = false, false
+	lastStatus = 0
+	run("batch " + filename + " --rsh-expect status==404")
+	assert.Equal(t, 4, GetExitCode())
+	lastStatus = 0
+}
@@ -0,0 +1,221 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// exportFormats are the supported `--rsh-export` formats.
+var exportFormats = map[string]func(p *RequestPreview) string{
+	"curl":            exportCurl,
+	"httpie":          exportHTTPie,
+	"go":              exportGo,
+	"python-requests": exportPython,
+}
+
+// exportFormatNames returns the sorted names of the supported export formats.
+func exportFormatNames() []string {
+	names := make([]string, 0, len(exportFormats))
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// exportRequest returns a snippet in the given format which makes the same
+// request as the preview.
+func exportRequest(format string, p *RequestPreview) (string, error) {
+	f := exportFormats[format]
+	if f == nil {
+		return "", fmt.Errorf("unknown export format %s, expected one of %s", format, strings.Join(exportFormatNames(), ", "))
+	}
+	return f(p), nil
+}
+
+// exportHeaders returns the sorted header names & values to export. The
+// `Host` header is implied by the URL, and `Accept-Encoding` is left to the
+// tool so that it can decompress the response. The body has already been
+// decompressed, so it's sent as-is.
+func exportHeaders(p *RequestPreview) [][2]string {
+	host := ""
+	if u, err := url.Parse(p.URL); err == nil {
+		host = u.Host
+	}
+
+	names := make([]string, 0, len(p.header))
+	for name := range p.header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := [][2]string{}
+	for _, name := range names {
+		switch http.CanonicalHeaderKey(name) {
+		case "Accept-Encoding", "Content-Encoding", "Content-Length":
+			continue
+		case "Host":
+			if p.header.Get(name) == host {
+				continue
+			}
+		}
+		for _, v := range p.header[name] {
+			headers = append(headers, [2]string{http.CanonicalHeaderKey(name), v})
+		}
+	}
+	return headers
+}
+
+// shellQuote quotes a string for POSIX shells.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// shellBody returns a prefix to pipe binary bodies into a command, and the
+// argument to use with the command for the body.
+func shellBody(p *RequestPreview, inline func(string) string, stdin string) (string, string) {
+	if len(p.raw) == 0 {
+		return "", ""
+	}
+	if utf8.Valid(p.raw) {
+		return "", inline(shellQuote(string(p.raw)))
+	}
+	return "echo " + shellQuote(base64.StdEncoding.EncodeToString(p.raw)) + " | base64 -d | ", stdin
+}
+
+func exportCurl(p *RequestPreview) string {
+	prefix, body := shellBody(p, func(s string) string {
+		return "--data-binary " + s
+	}, "--data-binary @-")
+
+	parts := []string{"curl --compressed"}
+	if p.Method != http.MethodGet || body != "" {
+		parts[0] += " -X " + p.Method
+	}
+	parts[0] += " " + shellQuote(p.URL)
+
+	for _, h := range exportHeaders(p) {
+		parts = append(parts, "-H "+shellQuote(h[0]+": "+h[1]))
+	}
+	if body != "" {
+		parts = append(parts, body)
+	}
+
+	return prefix + strings.Join(parts, " \\\n  ") + "\n"
+}
+
+func exportHTTPie(p *RequestPreview) string {
+	prefix, body := shellBody(p, func(s string) string {
+		return "--raw " + s
+	}, "")
+
+	parts := []string{"http " + p.Method + " " + shellQuote(p.URL)}
+	for _, h := range exportHeaders(p) {
+		parts = append(parts, shellQuote(h[0]+":"+h[1]))
+	}
+	if body != "" {
+		parts = append(parts, body)
+	}
+
+	return prefix + strings.Join(parts, " \\\n  ") + "\n"
+}
+
+func exportGo(p *RequestPreview) string {
+	buf := &bytes.Buffer{}
+	imports := []string{"fmt", "io", "net/http"}
+	bodyExpr := "nil"
+	if len(p.raw) > 0 {
+		if utf8.Valid(p.raw) {
+			imports = append(imports, "strings")
+			bodyExpr = "strings.NewReader(" + strconv.Quote(string(p.raw)) + ")"
+		} else {
+			imports = append(imports, "bytes")
+			bodyExpr = "bytes.NewReader([]byte(" + strconv.Quote(string(p.raw)) + "))"
+		}
+	}
+	sort.Strings(imports)
+
+	buf.WriteString("package main\n\nimport (\n")
+	for _, imp := range imports {
+		fmt.Fprintf(buf, "\t%q\n", imp)
+	}
+	buf.WriteString(")\n\nfunc main() {\n")
+	fmt.Fprintf(buf, "\treq, err := http.NewRequest(%q, %q, %s)\n", p.Method, p.URL, bodyExpr)
+	buf.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	for _, h := range exportHeaders(p) {
+		if h[0] == "Host" {
+			fmt.Fprintf(buf, "\treq.Host = %q\n", h[1])
+			continue
+		}
+		fmt.Fprintf(buf, "\treq.Header.Add(%q, %q)\n", h[0], h[1])
+	}
+	buf.WriteString("\n\tresp, err := http.DefaultClient.Do(req)\n")
+	buf.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	buf.WriteString("\tdefer resp.Body.Close()\n\n")
+	buf.WriteString("\tbody, err := io.ReadAll(resp.Body)\n")
+	buf.WriteString("\tif err != nil {\n\t\tpanic(err)\n\t}\n")
+	buf.WriteString("\tfmt.Println(resp.Status)\n")
+	buf.WriteString("\tfmt.Println(string(body))\n")
+	buf.WriteString("}\n")
+
+	return buf.String()
+}
+
+// pythonString returns a Python string literal. JSON strings are valid
+// Python strings.
+func pythonString(s string) string {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+func exportPython(p *RequestPreview) string {
+	buf := &bytes.Buffer{}
+	binary := len(p.raw) > 0 && !utf8.Valid(p.raw)
+	if binary {
+		buf.WriteString("import base64\n")
+	}
+	buf.WriteString("import requests\n\n")
+
+	// Repeated headers are combined, since requests takes a dict.
+	names := []string{}
+	values := map[string][]string{}
+	for _, h := range exportHeaders(p) {
+		if values[h[0]] == nil {
+			names = append(names, h[0])
+		}
+		values[h[0]] = append(values[h[0]], h[1])
+	}
+
+	buf.WriteString("response = requests.request(\n")
+	fmt.Fprintf(buf, "    %s,\n    %s,\n", pythonString(p.Method), pythonString(p.URL))
+	if len(names) > 0 {
+		buf.WriteString("    headers={\n")
+		for _, name := range names {
+			fmt.Fprintf(buf, "        %s: %s,\n", pythonString(name), pythonString(strings.Join(values[name], ", ")))
+		}
+		buf.WriteString("    },\n")
+	}
+	if len(p.raw) > 0 {
+		if binary {
+			fmt.Fprintf(buf, "    data=base64.b64decode(%s),\n", pythonString(base64.StdEncoding.EncodeToString(p.raw)))
+		} else {
+			fmt.Fprintf(buf, "    data=%s.encode(\"utf-8\"),\n", pythonString(string(p.raw)))
+		}
+	}
+	buf.WriteString(")\n\n")
+	buf.WriteString("print(response.status_code)\n")
+	buf.WriteString("print(response.text)\n")
+
+	return buf.String()
+}
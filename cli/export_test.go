@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"go/format"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func testPreview(t *testing.T, body string) *RequestPreview {
+	var req *http.Request
+	if body != "" {
+		req, _ = http.NewRequest(http.MethodPost, "https://api.example.com/items?q=it's", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req, _ = http.NewRequest(http.MethodGet, "https://api.example.com/items", nil)
+	}
+	req.Header.Set("Authorization", "Bearer abc123")
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	p, err := previewRequest(nil, req, true)
+	assert.NoError(t, err)
+	return p
+}
+
+func TestExportCurl(t *testing.T) {
+	snippet, err := exportRequest("curl", testPreview(t, `{"name": "it's"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `curl --compressed -X POST 'https://api.example.com/items?q=it'\''s' \
+  -H 'Authorization: Bearer abc123' \
+  -H 'Content-Type: application/json' \
+  --data-binary '{"name": "it'\''s"}'
+`, snippet)
+
+	snippet, err = exportRequest("curl", testPreview(t, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, `curl --compressed 'https://api.example.com/items' \
+  -H 'Authorization: Bearer abc123'
+`, snippet)
+
+	// Binary bodies are piped in so they survive the shell.
+	snippet, err = exportRequest("curl", testPreview(t, "\xff\x00"))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(snippet, "echo '/wA=' | base64 -d | curl"))
+	assert.Contains(t, snippet, "--data-binary @-")
+}
+
+func TestExportHTTPie(t *testing.T) {
+	snippet, err := exportRequest("httpie", testPreview(t, `{"name": "foo"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `http POST 'https://api.example.com/items?q=it'\''s' \
+  'Authorization:Bearer abc123' \
+  'Content-Type:application/json' \
+  --raw '{"name": "foo"}'
+`, snippet)
+}
+
+func TestExportGo(t *testing.T) {
+	snippet, err := exportRequest("go", testPreview(t, `{"name": "foo"}`))
+	assert.NoError(t, err)
+	assert.Contains(t, snippet, `http.NewRequest("POST", "https://api.example.com/items?q=it's", strings.NewReader("{\"name\": \"foo\"}"))`)
+	assert.Contains(t, snippet, `req.Header.Add("Authorization", "Bearer abc123")`)
+
+	// The generated code should already be formatted.
+	formatted, err := format.Source([]byte(snippet))
+	assert.NoError(t, err)
+	assert.Equal(t, snippet, string(formatted))
+}
+
+func TestExportPython(t *testing.T) {
+	snippet, err := exportRequest("python-requests", testPreview(t, `{"name": "foo"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, `import requests
+
+response = requests.request(
+    "POST",
+    "https://api.example.com/items?q=it's",
+    headers={
+        "Authorization": "Bearer abc123",
+        "Content-Type": "application/json",
+    },
+    data="{\"name\": \"foo\"}".encode("utf-8"),
+)
+
+print(response.status_code)
+print(response.text)
+`, snippet)
+
+	_, err = exportRequest("bad", testPreview(t, ""))
+	assert.ErrorContains(t, err, "unknown export format")
+}
+
+func TestExportCommand(t *testing.T) {
+	defer gock.Off()
+	defer reset(false)
+
+	reset(false)
+	configs["export-test"] = &APIConfig{
+		name: "export-test",
+		Base: "http://export.example.com",
+		Profiles: map[string]*APIProfile{
+			"default": {
+				Auth: &APIAuth{
+					Name:   "http-basic",
+					Params: map[string]string{"username": "alice", "password": "secret"},
+				},
+			},
+		},
+	}
+	defer delete(configs, "export-test")
+
+	// Auth headers are resolved and included, and nothing is sent.
+	captured := runNoReset("get export-test/items --rsh-export curl")
+	assert.Contains(t, captured, "curl --compressed 'http://export.example.com/items'")
+	assert.Contains(t, captured, "-H 'Authorization: Basic YWxpY2U6c2VjcmV0'")
+	assert.NotContains(t, captured, "ERROR")
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// isFormMediaType returns whether a media type is a form which is built from
+// individual fields rather than marshalled.
+func isFormMediaType(mediaType string) bool {
+	mt, _, _ := mime.ParseMediaType(mediaType)
+	return mt == "application/x-www-form-urlencoded" || mt == "multipart/form-data"
+}
+
+// formField is a single field in a form body. Exactly one of `value`, `data`,
+// or `file` is used.
+type formField struct {
+	name        string
+	value       string
+	contentType string
+	data        []byte
+	file        string
+}
+
+// formFields converts structured input into form fields. Arrays become
+// repeated fields and nested objects are sent as JSON. If `files` is set,
+// then string values like `@filename` are file references.
+func formFields(input any, files bool) ([]formField, error) {
+	m, ok := input.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("form input must be an object but got %T", input)
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	fields := []formField{}
+	for _, k := range keys {
+		values, ok := m[k].([]any)
+		if !ok {
+			values = []any{m[k]}
+		}
+
+		for _, v := range values {
+			field := formField{name: k}
+
+			switch t := v.(type) {
+			case nil:
+				// Empty value.
+			case string:
+				if files && strings.HasPrefix(t, "@") && len(t) > 1 {
+					// The file's content type can be set like with curl, e.g.
+					// `@logo.png;type=image/png`.
+					field.file = t[1:]
+					if path, ct, ok := strings.Cut(field.file, ";type="); ok {
+						if _, err := os.Stat(field.file); err != nil {
+							field.file, field.contentType = path, ct
+						}
+					}
+					if _, err := os.Stat(field.file); err != nil {
+						return nil, fmt.Errorf("unable to read file for field %s: %w", k, err)
+					}
+				} else {
+					field.value = t
+				}
+			case []byte:
+				field.data = t
+				field.contentType = "application/octet-stream"
+			case map[string]any, []any:
+				b, err := json.Marshal(t)
+				if err != nil {
+					return nil, err
+				}
+				field.value = string(b)
+				field.contentType = "application/json"
+			default:
+				field.value = fmt.Sprintf("%v", t)
+			}
+
+			fields = append(fields, field)
+		}
+	}
+
+	return fields, nil
+}
+
+// encodeURLForm encodes fields as `application/x-www-form-urlencoded`.
+func encodeURLForm(fields []formField) string {
+	values := url.Values{}
+	for _, f := range fields {
+		if f.data != nil {
+			values.Add(f.name, string(f.data))
+		} else {
+			values.Add(f.name, f.value)
+		}
+	}
+	return values.Encode()
+}
+
+// multipartBody streams a `multipart/form-data` body so that large files
+// are never loaded into memory.
+type multipartBody struct {
+	io.ReadCloser
+	fields   []formField
+	boundary string
+}
+
+// newMultipartBody creates a multipart body for the given fields.
+func newMultipartBody(fields []formField) *multipartBody {
+	b := &multipartBody{
+		fields:   fields,
+		boundary: multipart.NewWriter(nil).Boundary(),
+	}
+	b.ReadCloser, _ = b.open()
+	return b
+}
+
+// ContentType returns the content type header value including the boundary.
+func (b *multipartBody) ContentType() string {
+	return "multipart/form-data; boundary=" + b.boundary
+}
+
+// open returns a new reader for the body, e.g. to send it again on retry.
+// The body is only written once it is first read, so a body which is never
+// sent, e.g. because the request failed, doesn't leave a goroutine behind.
+func (b *multipartBody) open() (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+
+	return &lazyPipe{PipeReader: pr, write: func() {
+		w := multipart.NewWriter(pw)
+		w.SetBoundary(b.boundary)
+		for _, f := range b.fields {
+			if err := writeFormPart(w, f); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(w.Close())
+	}}, nil
+}
+
+// lazyPipe is the reading half of a pipe whose writer is started in a new
+// goroutine on the first read.
+type lazyPipe struct {
+	*io.PipeReader
+	once  sync.Once
+	write func()
+}
+
+func (p *lazyPipe) Read(b []byte) (int, error) {
+	p.once.Do(func() { go p.write() })
+	return p.PipeReader.Read(b)
+}
+
+// writeFormPart writes a single field, streaming file contents from disk.
+func writeFormPart(w *multipart.Writer, f formField) error {
+	h := textproto.MIMEHeader{}
+
+	if f.file == "" {
+		disposition := map[string]string{"name": f.name}
+		if f.data != nil {
+			disposition["filename"] = f.name
+		}
+		h.Set("Content-Disposition", mime.FormatMediaType("form-data", disposition))
+		if f.contentType != "" {
+			h.Set("Content-Type", f.contentType)
+		}
+
+		part, err := w.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if f.data != nil {
+			_, err = part.Write(f.data)
+		} else {
+			_, err = io.WriteString(part, f.value)
+		}
+		return err
+	}
+
+	file, err := os.Open(f.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Prefer the extension to detect the type, falling back to sniffing the
+	// start of the file.
+	r := bufio.NewReader(file)
+	ct := f.contentType
+	if ct == "" {
+		ct = mime.TypeByExtension(filepath.Ext(f.file))
+	}
+	if ct == "" {
+		start, _ := r.Peek(512)
+		ct = http.DetectContentType(start)
+	}
+
+	h.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{
+		"name":     f.name,
+		"filename": filepath.Base(f.file),
+	}))
+	h.Set("Content-Type", ct)
+
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(part, r)
+	return err
+}
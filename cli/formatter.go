@@ -528,6 +528,10 @@ func (f *DefaultFormatter) formatAuto(format string, resp Response) ([]byte, err
 	var err error
 	var encoded []byte
 
+	if viper.GetBool("rsh-timing") && resp.Timing != nil {
+		text += "\nTiming: " + resp.Timing.String() + "\n"
+	}
+
 	if f.color {
 		encoded, err = Highlight("http", []byte(text))
 		if err != nil {
@@ -591,6 +595,10 @@ func (f *DefaultFormatter) formatAuto(format string, resp Response) ([]byte, err
 
 // Format will filter, prettify, colorize and output the data.
 func (f *DefaultFormatter) Format(resp Response) error {
+	if resp.page {
+		return f.formatPage(resp)
+	}
+
 	var err error
 	outFormat := viper.GetString("rsh-output-format")
 	filter := viper.GetString("rsh-filter")
@@ -610,12 +618,15 @@ func (f *DefaultFormatter) Format(resp Response) error {
 		if f.tty {
 			// Live terminal: readable output
 			outFormat = "readable"
+		} else if resp.streamed {
+			// Redirected streaming output: one JSON item per line.
+			outFormat = "jsonl"
 		} else {
 			// Redirected (e.g. file or pipe) output: JSON for easier scripting.
 			outFormat = "json"
 		}
 	}
-	if !f.tty && filter == "" {
+	if (!f.tty || resp.streamed) && filter == "" {
 		filter = "body"
 	}
 
@@ -655,6 +666,9 @@ func (f *DefaultFormatter) Format(resp Response) error {
 		} else {
 			encoded, err = MarshalShort(outFormat, true, data)
 			lexer = outFormat
+			if lexer == "jsonl" {
+				lexer = "json"
+			}
 		}
 	}
 
@@ -680,3 +694,73 @@ func (f *DefaultFormatter) Format(resp Response) error {
 
 	return nil
 }
+
+// formatPage formats each item in a page of a paginated response on its own,
+// as if it were streamed, so that filters apply to each item. Tables instead
+// show the page's items as rows of a single table.
+func (f *DefaultFormatter) formatPage(resp Response) error {
+	items, _ := resp.Body.([]any)
+	resp.page = false
+	resp.streamed = true
+
+	if viper.GetString("rsh-output-format") != "table" {
+		for _, item := range items {
+			resp.Body = item
+			if err := f.Format(resp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	filter := viper.GetString("rsh-filter")
+	rows := make([]any, 0, len(items))
+	for _, item := range items {
+		if filter != "" && filter != "body" {
+			resp.Body = item
+			filtered, err := f.filterData(filter, resp.Map())
+			if err != nil {
+				return err
+			}
+			if filtered == nil {
+				continue
+			}
+			item = filtered
+		}
+		rows = append(rows, item)
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	encoded, err := MarshalShort("table", true, rows)
+	if err != nil {
+		return err
+	}
+	if encoded[len(encoded)-1] != '\n' {
+		encoded = append(encoded, '\n')
+	}
+	Stdout.Write(encoded)
+	return nil
+}
+
+// printStructured writes a value to stdout using the current output format,
+// defaulting to JSON. This is used by commands which don't make a request,
+// like showing stored cookies.
+func printStructured(value any) {
+	outFormat := viper.GetString("rsh-output-format")
+	if outFormat == "auto" {
+		outFormat = "json"
+	}
+	marshalled, err := MarshalShort(outFormat, true, value)
+	if err != nil {
+		panic(err)
+	}
+	if useColor {
+		if marshalled, err = Highlight(outFormat, marshalled); err != nil {
+			panic(err)
+		}
+	}
+	Stdout.Write(marshalled)
+}
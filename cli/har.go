@@ -0,0 +1,495 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// harRedacted replaces sensitive values in HAR files.
+const harRedacted = "REDACTED"
+
+// harSensitiveHeaders are header names whose values are redacted.
+var harSensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// harSensitiveFields are form and top-level JSON fields whose values are
+// redacted, e.g. for OAuth token requests and responses.
+var harSensitiveFields = map[string]bool{
+	"access_token":  true,
+	"client_secret": true,
+	"id_token":      true,
+	"password":      true,
+	"refresh_token": true,
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string         `json:"mimeType"`
+	Params   []harNameValue `json:"params,omitempty"`
+	Text     string         `json:"text"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+// harSensitiveParams are query param names whose values are redacted, in
+// addition to the sensitive fields.
+var harSensitiveParams = map[string]bool{
+	"api_key":   true,
+	"apikey":    true,
+	"code":      true,
+	"key":       true,
+	"secret":    true,
+	"sig":       true,
+	"signature": true,
+	"token":     true,
+}
+
+// harTrailer closes the entries list and the log. It is always the end of the
+// file so the file is valid JSON after each entry is written.
+const harTrailer = "\n    ]\n  }\n}\n"
+
+// harRecorder writes HTTP exchanges to a HAR 1.2 file as they complete.
+type harRecorder struct {
+	mu      sync.Mutex
+	path    string
+	unsafe  bool
+	entries int
+}
+
+var harRecordersMu sync.Mutex
+var harRecorders = map[string]*harRecorder{}
+
+// getHARRecorder returns the recorder for the given file path, creating it as
+// needed. All requests made during a single run are written to the same file.
+func getHARRecorder(path string, unsafe bool) *harRecorder {
+	harRecordersMu.Lock()
+	defer harRecordersMu.Unlock()
+
+	r := harRecorders[path]
+	if r == nil {
+		r = &harRecorder{path: path}
+		harRecorders[path] = r
+	}
+	r.unsafe = unsafe
+
+	return r
+}
+
+// add an entry to the HAR file. Each entry is written over the trailer,
+// followed by a new trailer, so the file is always complete, even if the
+// program exits unexpectedly, without rewriting or keeping earlier entries.
+func (r *harRecorder) add(entry harEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(entry, "      ", "  ")
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_RDWR
+	if r.entries == 0 {
+		flags |= os.O_CREATE | os.O_TRUNC
+	}
+	f, err := os.OpenFile(r.path, flags, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	buf := &bytes.Buffer{}
+	if r.entries == 0 {
+		version := "dev"
+		if Root != nil && Root.Version != "" {
+			version = Root.Version
+		}
+		creator, _ := json.Marshal(harCreator{Name: "restish", Version: version})
+		fmt.Fprintf(buf, "{\n  \"log\": {\n    \"version\": \"1.2\",\n    \"creator\": %s,\n    \"entries\": [\n      ", creator)
+	} else {
+		if _, err := f.Seek(-int64(len(harTrailer)), io.SeekEnd); err != nil {
+			return err
+		}
+		buf.WriteString(",\n      ")
+	}
+	buf.Write(data)
+	buf.WriteString(harTrailer)
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	r.entries++
+
+	return nil
+}
+
+// query converts a URL's query params into HAR name/value pairs and returns
+// the URL, redacting sensitive values in both.
+func (r *harRecorder) query(u *url.URL) ([]harNameValue, string) {
+	values := []harNameValue{}
+	query := u.Query()
+	redacted := false
+	for k, list := range query {
+		for i, v := range list {
+			if !r.unsafe && (harSensitiveParams[strings.ToLower(k)] || harSensitiveFields[strings.ToLower(k)]) {
+				v = harRedacted
+				list[i] = v
+				redacted = true
+			}
+			values = append(values, harNameValue{Name: k, Value: v})
+		}
+	}
+
+	if !redacted {
+		return values, u.String()
+	}
+
+	copied := *u
+	copied.RawQuery = query.Encode()
+	return values, copied.String()
+}
+
+// headers converts HTTP headers into HAR name/value pairs, redacting
+// sensitive values.
+func (r *harRecorder) headers(header http.Header) []harNameValue {
+	values := []harNameValue{}
+	for name, list := range header {
+		for _, v := range list {
+			if !r.unsafe && harSensitiveHeaders[http.CanonicalHeaderKey(name)] {
+				v = harRedacted
+			}
+			values = append(values, harNameValue{Name: name, Value: v})
+		}
+	}
+	return values
+}
+
+// cookies converts HTTP cookies into HAR name/value pairs, redacting values.
+func (r *harRecorder) cookies(cookies []*http.Cookie) []harNameValue {
+	values := []harNameValue{}
+	for _, c := range cookies {
+		v := c.Value
+		if !r.unsafe {
+			v = harRedacted
+		}
+		values = append(values, harNameValue{Name: c.Name, Value: v})
+	}
+	return values
+}
+
+// body returns the HAR representation of a body, redacting sensitive fields.
+func (r *harRecorder) body(contentType string, body []byte) (text string, encoding string) {
+	if !r.unsafe {
+		body = redactBody(contentType, body)
+	}
+
+	if !utf8.Valid(body) {
+		return base64.StdEncoding.EncodeToString(body), "base64"
+	}
+
+	return string(body), ""
+}
+
+// redactBody replaces the values of sensitive form and top-level JSON fields.
+func redactBody(contentType string, body []byte) []byte {
+	mt, _, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case mt == "application/x-www-form-urlencoded":
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			for k := range values {
+				if harSensitiveFields[k] {
+					values.Set(k, harRedacted)
+				}
+			}
+			body = []byte(values.Encode())
+		}
+	case (&JSON{}).Detect(contentType):
+		var m map[string]any
+		if json.Unmarshal(body, &m) == nil {
+			changed := false
+			for k := range m {
+				if harSensitiveFields[k] {
+					m[k] = harRedacted
+					changed = true
+				}
+			}
+			if changed {
+				body, _ = json.Marshal(m)
+			}
+		}
+	}
+
+	return body
+}
+
+// harTransport records each exchange made via the wrapped transport.
+type harTransport struct {
+	recorder  *harRecorder
+	transport http.RoundTripper
+}
+
+// RoundTrip makes the request and records it once the response body has been
+// read or closed.
+func (t *harTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		reqBody, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	timing := &Timing{start: time.Now()}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timing.trace()))
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	resp.Body = &captureBody{
+		ReadCloser: resp.Body,
+		done: func(body []byte) {
+			if err := t.recorder.add(t.entry(req, reqBody, resp, body, timing)); err != nil {
+				LogWarning("Unable to write HAR file: %v", err)
+			}
+		},
+	}
+
+	return resp, nil
+}
+
+// entry builds a HAR entry for a completed exchange.
+func (t *harTransport) entry(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, timing *Timing) harEntry {
+	r := t.recorder
+	total := time.Since(timing.start)
+
+	timing.mu.Lock()
+	firstByte := timing.FirstByte
+	timings := harTimings{
+		Blocked: -1,
+		DNS:     -1,
+		Connect: -1,
+		SSL:     -1,
+		Send:    0,
+		Wait:    ms(firstByte - timing.DNS - timing.Connect - timing.TLS),
+		Receive: ms(total - firstByte),
+	}
+	if timing.DNS > 0 {
+		timings.DNS = ms(timing.DNS)
+	}
+	if timing.Connect > 0 {
+		// HAR connect time includes the TLS handshake.
+		timings.Connect = ms(timing.Connect + timing.TLS)
+	}
+	if timing.TLS > 0 {
+		timings.SSL = ms(timing.TLS)
+	}
+	timing.mu.Unlock()
+
+	query, u := r.query(req.URL)
+
+	entry := harEntry{
+		StartedDateTime: timing.start.Format(time.RFC3339Nano),
+		Time:            ms(total),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         u,
+			HTTPVersion: req.Proto,
+			Cookies:     r.cookies(req.Cookies()),
+			Headers:     r.headers(req.Header),
+			QueryString: query,
+			HeadersSize: -1,
+			BodySize:    len(reqBody),
+		},
+		Response: harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Cookies:     r.cookies(resp.Cookies()),
+			Headers:     r.headers(resp.Header),
+			RedirectURL: resp.Header.Get("Location"),
+			HeadersSize: -1,
+			BodySize:    len(respBody),
+		},
+		Timings: timings,
+	}
+
+	if entry.Request.HTTPVersion == "" {
+		entry.Request.HTTPVersion = "HTTP/1.1"
+	}
+
+	if reqBody != nil {
+		ct := req.Header.Get("Content-Type")
+		text, _ := r.body(ct, reqBody)
+		entry.Request.PostData = &harPostData{MimeType: ct, Text: text}
+	}
+
+	// Bodies are stored decoded, e.g. after removing gzip compression.
+	decoded := &http.Response{Header: resp.Header, Body: io.NopCloser(bytes.NewReader(respBody))}
+	if err := DecodeResponse(decoded); err == nil {
+		if b, err := io.ReadAll(decoded.Body); err == nil {
+			respBody = b
+		}
+	}
+
+	ct := resp.Header.Get("Content-Type")
+	text, encoding := r.body(ct, respBody)
+	entry.Response.Content = harContent{
+		Size:     len(respBody),
+		MimeType: ct,
+		Text:     text,
+		Encoding: encoding,
+	}
+
+	return entry
+}
+
+// ms converts a duration into fractional milliseconds.
+func ms(d time.Duration) float64 {
+	if d < 0 {
+		return 0
+	}
+	return float64(d) / float64(time.Millisecond)
+}
+
+// captureMemory is how much of a captured body is kept in memory before the
+// rest is spooled to a temporary file, e.g. for long-running event streams.
+var captureMemory = 1 << 20
+
+// captureBody captures a response body as it is read, calling `done` once with
+// the full body after the end is reached or the body is closed. Reads are
+// passed straight through, so streaming responses arrive as they are sent.
+type captureBody struct {
+	io.ReadCloser
+	buf   bytes.Buffer
+	spool *os.File
+	once  sync.Once
+	done  func(body []byte)
+}
+
+func (b *captureBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.write(p[:n])
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *captureBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+// write tees the data into the in-memory buffer or, once that grows too large,
+// into the spool file.
+func (b *captureBody) write(p []byte) {
+	if b.spool == nil && b.buf.Len()+len(p) > captureMemory {
+		if f, err := os.CreateTemp("", "restish-capture-*"); err == nil {
+			f.Write(b.buf.Bytes())
+			b.buf = bytes.Buffer{}
+			b.spool = f
+		}
+	}
+
+	if b.spool != nil {
+		b.spool.Write(p)
+	} else {
+		b.buf.Write(p)
+	}
+}
+
+// finish calls `done` with the captured body and removes any spool file.
+func (b *captureBody) finish() {
+	b.once.Do(func() {
+		body := b.buf.Bytes()
+		if b.spool != nil {
+			b.spool.Close()
+			if data, err := os.ReadFile(b.spool.Name()); err == nil {
+				body = data
+			}
+			os.Remove(b.spool.Name())
+		}
+		b.done(body)
+	})
+}
@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func readHAR(t *testing.T, path string) map[string]any {
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	var har map[string]any
+	assert.NoError(t, json.Unmarshal(data, &har))
+	return har
+}
+
+func TestHAR(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	path := filepath.Join(t.TempDir(), "test.har")
+	viper.Set("rsh-har", path)
+
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	gz.Write([]byte(`{"access_token": "secret", "hello": "world"}`))
+	gz.Close()
+
+	gock.New("http://example.com").
+		Post("/items").
+		Reply(http.StatusOK).
+		SetHeader("Content-Type", "application/json").
+		SetHeader("Content-Encoding", "gzip").
+		SetHeader("Set-Cookie", "session=abc123").
+		Body(buf)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/items?q=1&api_key=secret", bytes.NewReader([]byte(`{"name": "test"}`)))
+	req.Header.Set("Authorization", "Bearer secret")
+	_, err := GetParsedResponse(req)
+	assert.NoError(t, err)
+
+	har := readHAR(t, path)
+	log := har["log"].(map[string]any)
+	assert.Equal(t, "1.2", log["version"])
+
+	entries := log["entries"].([]any)
+	if assert.Len(t, entries, 1) {
+		entry := entries[0].(map[string]any)
+		request := entry["request"].(map[string]any)
+		response := entry["response"].(map[string]any)
+
+		assert.Equal(t, "POST", request["method"])
+		assert.Equal(t, "http://example.com/items?api_key=REDACTED&q=1", request["url"])
+		assert.Contains(t, request["headers"], map[string]any{"name": "Authorization", "value": "REDACTED"})
+		assert.Equal(t, `{"name": "test"}`, request["postData"].(map[string]any)["text"])
+		assert.Contains(t, request["queryString"], map[string]any{"name": "q", "value": "1"})
+		assert.Contains(t, request["queryString"], map[string]any{"name": "api_key", "value": "REDACTED"})
+
+		assert.Equal(t, 200.0, response["status"])
+		assert.Contains(t, response["headers"], map[string]any{"name": "Set-Cookie", "value": "REDACTED"})
+		assert.Contains(t, response["cookies"], map[string]any{"name": "session", "value": "REDACTED"})
+		assert.JSONEq(t, `{"access_token": "REDACTED", "hello": "world"}`, response["content"].(map[string]any)["text"].(string))
+		assert.Contains(t, entry, "timings")
+	}
+
+	// Unsafe mode keeps the secrets.
+	viper.Set("rsh-har-unsafe", true)
+	gock.New("http://example.com").
+		Get("/items").
+		Reply(http.StatusOK).
+		JSON(map[string]any{"access_token": "secret"})
+
+	req, _ = http.NewRequest(http.MethodGet, "http://example.com/items?token=secret", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	_, err = GetParsedResponse(req)
+	assert.NoError(t, err)
+
+	entries = readHAR(t, path)["log"].(map[string]any)["entries"].([]any)
+	if assert.Len(t, entries, 2) {
+		request := entries[1].(map[string]any)["request"].(map[string]any)
+		assert.Contains(t, request["headers"], map[string]any{"name": "Authorization", "value": "Bearer secret"})
+		assert.Equal(t, "http://example.com/items?token=secret", request["url"])
+		response := entries[1].(map[string]any)["response"].(map[string]any)
+		assert.JSONEq(t, `{"access_token": "secret"}`, response["content"].(map[string]any)["text"].(string))
+	}
+}
+
+func TestHARTimings(t *testing.T) {
+	r := &harRecorder{}
+	transport := &harTransport{recorder: r}
+
+	timing := &Timing{
+		start:     time.Now().Add(-100 * time.Millisecond),
+		DNS:       10 * time.Millisecond,
+		Connect:   20 * time.Millisecond,
+		TLS:       30 * time.Millisecond,
+		FirstByte: 80 * time.Millisecond,
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/items", nil)
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+	entry := transport.entry(req, nil, resp, nil, timing)
+
+	assert.Equal(t, 10.0, entry.Timings.DNS)
+	assert.Equal(t, 50.0, entry.Timings.Connect)
+	assert.Equal(t, 30.0, entry.Timings.SSL)
+	assert.Equal(t, 20.0, entry.Timings.Wait)
+
+	// SSL time is part of the connect time, so it is not counted separately.
+	sum := entry.Timings.DNS + entry.Timings.Connect + entry.Timings.Send + entry.Timings.Wait + entry.Timings.Receive
+	assert.LessOrEqual(t, sum, entry.Time)
+}
+
+func TestHARStream(t *testing.T) {
+	defer func(orig int) { captureMemory = orig }(captureMemory)
+	captureMemory = 12
+
+	path := filepath.Join(t.TempDir(), "test.har")
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("data: 2\n\n"))
+	}))
+	defer server.Close()
+
+	transport := &harTransport{recorder: &harRecorder{path: path}, transport: http.DefaultTransport}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+
+	// The first event is available before the stream has finished.
+	buf := make([]byte, 9)
+	_, err = io.ReadFull(resp.Body, buf)
+	require.NoError(t, err)
+	assert.Equal(t, "data: 1\n\n", string(buf))
+	assert.NoFileExists(t, path)
+
+	// The entry is written with the full body once the stream is closed.
+	close(release)
+	_, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	entries := readHAR(t, path)["log"].(map[string]any)["entries"].([]any)
+	if assert.Len(t, entries, 1) {
+		content := entries[0].(map[string]any)["response"].(map[string]any)["content"].(map[string]any)
+		assert.Equal(t, "data: 1\n\ndata: 2\n\n", content["text"])
+	}
+}
+
+// cancelWriter cancels a request as soon as any output is written.
+type cancelWriter struct {
+	cancel context.CancelFunc
+}
+
+func (w cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return len(p), nil
+}
+
+func TestHARStreamStopped(t *testing.T) {
+	gock.Off()
+
+	reset(false)
+	path := filepath.Join(t.TempDir(), "test.har")
+	viper.Set("rsh-har", path)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: 1\n\n"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	// Stop the never-ending stream once the first event has been shown.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	Stdout = cancelWriter{cancel}
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/events", nil)
+	assert.NotPanics(t, func() {
+		MakeRequestAndFormat(req)
+	})
+
+	entries := readHAR(t, path)["log"].(map[string]any)["entries"].([]any)
+	if assert.Len(t, entries, 1) {
+		content := entries[0].(map[string]any)["response"].(map[string]any)["content"].(map[string]any)
+		assert.Equal(t, "data: 1\n\n", content["text"])
+	}
+}
@@ -1,15 +1,16 @@
 package cli
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"strings"
 
 	"github.com/danielgtaylor/shorthand/v2"
-	yaml "gopkg.in/yaml.v2"
+	"github.com/spf13/viper"
 )
 
 // Stdin represents the command input, which defaults to os.Stdin.
@@ -19,7 +20,8 @@ var Stdin interface {
 } = os.Stdin
 
 // GetBody returns the request body if one was passed either as shorthand
-// arguments or via stdin.
+// arguments or via stdin. Shorthand input is encoded using the registered
+// content type which matches the media type, e.g. JSON or CBOR.
 func GetBody(mediaType string, args []string) (string, error) {
 	var body string
 
@@ -45,17 +47,27 @@ func GetBody(mediaType string, args []string) (string, error) {
 	}
 
 	if input != nil {
-		if strings.Contains(mediaType, "json") {
-			marshalled, err := json.Marshal(input)
+		if isFormMediaType(mediaType) {
+			if strings.Contains(mediaType, "multipart") {
+				return "", fmt.Errorf("multipart bodies must be created with GetBodyReader")
+			}
+			fields, err := formFields(input, false)
 			if err != nil {
 				return "", err
 			}
-			body = string(marshalled)
-		} else if strings.Contains(mediaType, "yaml") {
-			marshalled, err := yaml.Marshal(input)
+			body = encodeURLForm(fields)
+		} else if ct := findContentType(mediaType); ct != nil {
+			// Use the same content type registry used to decode responses, so
+			// e.g. CBOR and custom registered formats can be sent too.
+			marshalled, err := ct.Marshal(input)
 			if err != nil {
 				return "", err
 			}
+			if _, ok := ct.(*JSON); ok {
+				// The JSON encoder always adds a trailing newline, which isn't part
+				// of the document.
+				marshalled = bytes.TrimSuffix(marshalled, []byte("\n"))
+			}
 			body = string(marshalled)
 		} else {
 			return "", fmt.Errorf("not sure how to marshal %s", mediaType)
@@ -64,3 +76,81 @@ func GetBody(mediaType string, args []string) (string, error) {
 
 	return body, nil
 }
+
+// GetBodyReader returns the request body if one was passed either as shorthand
+// arguments or via stdin, along with the content type to send, which is empty
+// for data passed through from stdin. For `multipart/form-data`, shorthand
+// fields become form fields and `@filename` values become file parts which
+// are streamed from disk.
+func GetBodyReader(mediaType string, args []string) (io.Reader, string, error) {
+	if !strings.Contains(mediaType, "multipart/form-data") {
+		body, err := GetBody(mediaType, args)
+		if err != nil || body == "" {
+			return nil, "", err
+		}
+
+		// Structured input was encoded as the media type, while data passed
+		// through from stdin is sent as-is.
+		contentType := ""
+		if len(args) > 0 {
+			contentType = mediaType
+		}
+		return strings.NewReader(body), contentType, nil
+	}
+
+	if info, err := Stdin.Stat(); err == nil {
+		if len(args) == 0 && (info.Mode()&os.ModeCharDevice) == 0 {
+			// Pass through data on stdin, which must already be encoded.
+			b, err := io.ReadAll(Stdin)
+			if err != nil || len(b) == 0 {
+				return nil, "", err
+			}
+			return bytes.NewReader(b), "", nil
+		}
+	}
+
+	// Files are streamed later rather than being loaded by shorthand.
+	input, _, err := shorthand.GetInput(args, shorthand.ParseOptions{
+		EnableObjectDetection: true,
+	})
+	if err != nil || input == nil {
+		return nil, "", err
+	}
+
+	fields, err := formFields(input, true)
+	if err != nil {
+		return nil, "", err
+	}
+
+	body := newMultipartBody(fields)
+	return body, body.ContentType(), nil
+}
+
+// setBodyContentType prepares a request created with a body from
+// `GetBodyReader`. A content type passed by the user, e.g. via `-H`, is
+// replaced since it can't include the generated multipart boundary.
+func setBodyContentType(req *http.Request, body io.Reader, contentType string) {
+	if b, ok := body.(*multipartBody); ok {
+		// Streamed bodies are re-created for retries instead of being buffered.
+		req.GetBody = b.open
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+}
+
+// bodyMediaType returns the media type to use to encode a request body, which
+// is the `Content-Type` header passed by the user, e.g. via `-H`, if the body
+// can be encoded that way, otherwise the given default.
+func bodyMediaType(defaultType string) string {
+	mediaType := defaultType
+	for _, h := range viper.GetStringSlice("rsh-header") {
+		name, value, _ := strings.Cut(h, ":")
+		value = strings.TrimSpace(value)
+		if strings.EqualFold(strings.TrimSpace(name), "content-type") && (isFormMediaType(value) || findContentType(value) != nil) {
+			mediaType = value
+		}
+	}
+	return mediaType
+}
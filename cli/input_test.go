@@ -1,12 +1,22 @@
 package cli
 
 import (
+	"fmt"
+	"io"
 	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"testing/fstest"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
 )
 
 func WithFakeStdin(data []byte, mode fs.FileMode, f func()) {
@@ -38,6 +48,46 @@ func TestInputStructuredYAML(t *testing.T) {
 	})
 }
 
+func TestInputStructuredCBOR(t *testing.T) {
+	WithFakeStdin([]byte{}, fs.ModeCharDevice, func() {
+		body, err := GetBody("application/cbor", []string{"foo: 1, bar: false"})
+		assert.NoError(t, err)
+
+		var decoded map[string]any
+		assert.NoError(t, cbor.Unmarshal([]byte(body), &decoded))
+		assert.Equal(t, map[string]any{"foo": uint64(1), "bar": false}, decoded)
+	})
+}
+
+// upperText is a custom content type used to test body encoding.
+type upperText struct{ Text }
+
+func (u upperText) Detect(contentType string) bool {
+	return contentType == "application/x-upper"
+}
+
+func (u upperText) Marshal(value any) ([]byte, error) {
+	return []byte(strings.ToUpper(fmt.Sprintf("%v", value))), nil
+}
+
+func TestInputCustomContentType(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	AddContentType("upper", "application/x-upper", 0.1, upperText{})
+
+	gock.New("http://example.com").
+		Post("/items").
+		MatchType("application/x-upper").
+		BodyString("HELLO").
+		Reply(http.StatusNoContent)
+
+	WithFakeStdin([]byte{}, fs.ModeCharDevice, func() {
+		runNoReset("post http://example.com/items -H Content-Type:application/x-upper hello")
+	})
+	assert.True(t, gock.IsDone())
+}
+
 func TestInputBinary(t *testing.T) {
 	WithFakeStdin([]byte("This is not JSON!"), 0, func() {
 		body, err := GetBody("", []string{})
@@ -52,3 +102,110 @@ func TestInputInvalidType(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestInputURLEncodedForm(t *testing.T) {
+	WithFakeStdin([]byte{}, fs.ModeCharDevice, func() {
+		body, err := GetBody("application/x-www-form-urlencoded", []string{"name: test, tags: [a, b], count: 5, meta{x: 1}"})
+		assert.NoError(t, err)
+		assert.Equal(t, "count=5&meta=%7B%22x%22%3A1%7D&name=test&tags=a&tags=b", body)
+
+		_, err = GetBody("application/x-www-form-urlencoded", []string{"[1, 2]"})
+		assert.Error(t, err)
+	})
+}
+
+// readMultipart reads all parts of a multipart body into a map of field name
+// to content type & value.
+func readMultipart(t *testing.T, contentType string, body io.Reader) map[string][2]string {
+	_, params, err := mime.ParseMediaType(contentType)
+	assert.NoError(t, err)
+
+	parts := map[string][2]string{}
+	r := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+		data, _ := io.ReadAll(part)
+		name := part.FormName()
+		if part.FileName() != "" {
+			name += ":" + part.FileName()
+		}
+		parts[name] = [2]string{part.Header.Get("Content-Type"), string(data)}
+	}
+	return parts
+}
+
+func TestInputMultipartForm(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0600)
+	os.WriteFile(filepath.Join(dir, "data"), []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n'}, 0600)
+
+	WithFakeStdin([]byte{}, fs.ModeCharDevice, func() {
+		body, contentType, err := GetBodyReader("multipart/form-data", []string{
+			"name: test, doc: @" + filepath.Join(dir, "notes.txt") + ", image: @" + filepath.Join(dir, "data"),
+		})
+		assert.NoError(t, err)
+		assert.Contains(t, contentType, "multipart/form-data; boundary=")
+
+		assert.Equal(t, map[string][2]string{
+			"name":          {"", "test"},
+			"doc:notes.txt": {"text/plain; charset=utf-8", "hello"},
+			"image:data":    {"image/png", "\x89PNG\r\n\x1a\n"},
+		}, readMultipart(t, contentType, body))
+
+		// The content type can be set for files.
+		body, contentType, err = GetBodyReader("multipart/form-data", []string{
+			"doc: @" + filepath.Join(dir, "notes.txt") + ";type=text/markdown",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][2]string{
+			"doc:notes.txt": {"text/markdown", "hello"},
+		}, readMultipart(t, contentType, body))
+
+		// Missing files are an error before any request is made.
+		_, _, err = GetBodyReader("multipart/form-data", []string{"doc: @" + filepath.Join(dir, "missing")})
+		assert.ErrorContains(t, err, "unable to read file for field doc")
+	})
+}
+
+func TestInputMultipartLazy(t *testing.T) {
+	fields := []formField{{name: "name", value: "test"}}
+
+	// Bodies which are never read don't start writing.
+	before := runtime.NumGoroutine()
+	for i := 0; i < 100; i++ {
+		newMultipartBody(fields)
+	}
+	assert.Less(t, runtime.NumGoroutine(), before+50)
+
+	body := newMultipartBody(fields)
+	assert.Equal(t, map[string][2]string{"name": {"", "test"}}, readMultipart(t, body.ContentType(), body))
+	assert.NoError(t, body.Close())
+}
+
+func TestInputMultipartRequest(t *testing.T) {
+	defer gock.Off()
+
+	filename := filepath.Join(t.TempDir(), "upload.json")
+	os.WriteFile(filename, []byte(`{"hello": "world"}`), 0600)
+
+	gock.New("http://example.com").
+		Post("/upload").
+		AddMatcher(func(req *http.Request, _ *gock.Request) (bool, error) {
+			parts := readMultipart(t, req.Header.Get("Content-Type"), req.Body)
+			return assert.Equal(t, map[string][2]string{
+				"title":            {"", "My upload"},
+				"file:upload.json": {"application/json", `{"hello": "world"}`},
+			}, parts), nil
+		}).
+		Reply(http.StatusCreated)
+
+	WithFakeStdin([]byte{}, fs.ModeCharDevice, func() {
+		captured := run("post http://example.com/upload -H Content-Type:multipart/form-data title: My upload, file: @" + filename)
+		assert.Contains(t, captured, "201 Created")
+	})
+	assert.True(t, gock.IsDone())
+}
@@ -42,7 +42,8 @@ func LogDebugRequest(req *http.Request) {
 // is enabled.
 func LogDebugResponse(start time.Time, resp *http.Response) {
 	if enableVerbose {
-		dumped, err := httputil.DumpResponse(resp, true)
+		// Streaming responses may never end, so don't try to read them.
+		dumped, err := httputil.DumpResponse(resp, !isStreaming(resp))
 		if err != nil {
 			return
 		}
@@ -54,6 +55,10 @@ func LogDebugResponse(start time.Time, resp *http.Response) {
 		}
 
 		LogDebug("Got response from server in %s:\n%s", time.Since(start), string(dumped))
+
+		if t := getTiming(resp); t != nil {
+			LogDebug("Timing: %s", t)
+		}
 	}
 }
 
@@ -29,6 +29,9 @@ type Operation struct {
 	Examples      []string `json:"examples,omitempty" yaml:"examples,omitempty"`
 	Hidden        bool     `json:"hidden,omitempty" yaml:"hidden,omitempty"`
 	Deprecated    string   `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+
+	// Pagination overrides the API's pagination config for this operation.
+	Pagination *PaginationConfig `json:"pagination,omitempty" yaml:"pagination,omitempty"`
 }
 
 // command returns a Cobra command instance for this operation.
@@ -128,18 +131,20 @@ func (o Operation) command() *cobra.Command {
 			}
 
 			var body io.Reader
+			var contentType string
 
 			if o.BodyMediaType != "" {
-				b, err := GetBody(o.BodyMediaType, args[len(o.PathParams):])
+				var err error
+				body, contentType, err = GetBodyReader(bodyMediaType(o.BodyMediaType), args[len(o.PathParams):])
 				if err != nil {
 					panic(err)
 				}
-				body = strings.NewReader(b)
 			}
 
 			req, _ := http.NewRequest(o.Method, uri, body)
 			req.Header = headers
-			MakeRequestAndFormat(req)
+			setBodyContentType(req, body, contentType)
+			MakeRequestAndFormat(req, WithPagination(o.Pagination))
 		},
 	}
 
@@ -1,7 +1,10 @@
 package cli
 
 import (
+	"io"
+	"io/fs"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -101,3 +104,61 @@ func TestOperation(t *testing.T) {
 
 	assert.Equal(t, "HTTP/1.1 200 OK\nContent-Type: application/json\n\n{\n  hello: \"world\"\n}\n", capture.String())
 }
+
+func TestOperationFormBody(t *testing.T) {
+	defer gock.Off()
+
+	gock.
+		New("http://example.com").
+		Post("/login").
+		MatchHeader("Content-Type", "application/x-www-form-urlencoded").
+		BodyString("password=secret&username=test").
+		Reply(http.StatusNoContent)
+
+	op := Operation{
+		Name:          "login",
+		Method:        http.MethodPost,
+		URITemplate:   "http://example.com/login",
+		BodyMediaType: "application/x-www-form-urlencoded",
+	}
+
+	cmd := op.command()
+
+	reset(false)
+	WithFakeStdin([]byte{}, fs.ModeCharDevice, func() {
+		cmd.Run(cmd, []string{"username: test, password: secret"})
+	})
+	assert.True(t, gock.IsDone())
+}
+
+func TestOperationBodyContentType(t *testing.T) {
+	gock.Off()
+	defer reset(false)
+
+	var contentTypes []string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes = r.Header.Values("Content-Type")
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	op := Operation{
+		Name:          "login",
+		Method:        http.MethodPost,
+		URITemplate:   server.URL + "/login",
+		BodyMediaType: "application/json",
+	}
+
+	cmd := op.command()
+
+	reset(false)
+	viper.Set("rsh-header", []string{"Content-Type: application/x-www-form-urlencoded"})
+	WithFakeStdin([]byte{}, fs.ModeCharDevice, func() {
+		cmd.Run(cmd, []string{"username: test, password: secret"})
+	})
+
+	assert.Equal(t, []string{"application/x-www-form-urlencoded"}, contentTypes)
+	assert.Equal(t, "password=secret&username=test", string(body))
+}
@@ -0,0 +1,254 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/danielgtaylor/shorthand/v2"
+	"github.com/spf13/viper"
+)
+
+// getPagination returns the pagination config to use for a request, if any.
+// Operation-specific config takes precedence over the API config.
+func getPagination(u *url.URL, options []requestOption) *PaginationConfig {
+	conf := &requestConfig{}
+	for _, opt := range options {
+		opt(conf)
+	}
+	if conf.pagination != nil {
+		return conf.pagination
+	}
+
+	if _, config := findAPI(u.String()); config != nil {
+		return config.Pagination
+	}
+	return nil
+}
+
+// getResponsePath returns the value at a shorthand query path within the
+// response, e.g. `body.items`, or nil if there is none.
+func getResponsePath(resp Response, path string) (any, error) {
+	result, _, err := shorthand.GetPath(path, resp.Map(), shorthand.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("invalid pagination path %s: %w", path, err)
+	}
+	return result, nil
+}
+
+// pageItems returns the items in a page of results and whether they are a
+// list which can be merged with other pages. If `more` is set, then the
+// response is known to be part of a paginated list, so missing items mean the
+// page is empty rather than that the response isn't a list at all.
+func pageItems(resp Response, p *PaginationConfig, more bool) ([]any, bool) {
+	if p == nil || p.Items == "" {
+		items, ok := resp.Body.([]any)
+		return items, ok
+	}
+
+	result, err := getResponsePath(resp, p.Items)
+	if err != nil {
+		LogWarning("%v", err)
+		return nil, false
+	}
+	if result == nil && more && resp.Status < 300 {
+		// Some APIs omit the items entirely for empty pages.
+		return []any{}, true
+	}
+	items, ok := result.([]any)
+	return items, ok
+}
+
+// nextPage returns the URL of the page of results after the response to a
+// request for `base`, or nil if it was the last page.
+func nextPage(base *url.URL, resp Response, p *PaginationConfig) (*url.URL, error) {
+	if p != nil && p.Next != "" {
+		result, err := getResponsePath(resp, p.Next)
+		if err != nil {
+			return nil, err
+		}
+		link, ok := result.(string)
+		if !ok || link == "" {
+			return nil, nil
+		}
+		next, err := url.Parse(link)
+		if err != nil {
+			return nil, fmt.Errorf("invalid next page link %s: %w", link, err)
+		}
+		next = base.ResolveReference(next)
+		if next.String() == base.String() {
+			LogWarning("Auto-pagination next page is the same as the current page, aborting")
+			return nil, nil
+		}
+		return next, nil
+	}
+
+	if p != nil && p.Cursor != "" {
+		result, err := getResponsePath(resp, p.Cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		cursor := ""
+		switch v := result.(type) {
+		case string:
+			cursor = v
+		case float64:
+			cursor = strconv.FormatFloat(v, 'f', -1, 64)
+		case nil, bool:
+			// Some APIs use `false` to signal there are no more pages.
+		default:
+			cursor = fmt.Sprintf("%v", v)
+		}
+		if cursor == "" {
+			return nil, nil
+		}
+
+		param := p.CursorParam
+		if param == "" {
+			param = "cursor"
+		}
+
+		next := *base
+		query := next.Query()
+		if query.Get(param) == cursor {
+			LogWarning("Auto-pagination cursor did not change, aborting")
+			return nil, nil
+		}
+		query.Set(param, cursor)
+		next.RawQuery = query.Encode()
+		return &next, nil
+	}
+
+	if links := resp.Links["next"]; len(links) > 0 {
+		next, _ := url.Parse(links[0].URI)
+		return base.ResolveReference(next), nil
+	}
+
+	return nil, nil
+}
+
+// pageFunc is called with each page of a paginated response and the items in
+// that page, which are nil if the body isn't a list that can be merged.
+type pageFunc func(page Response, items []any) error
+
+// paginate parses the response to a request that has already been made and
+// fetches any further pages, calling `fn` with each one as it arrives. The
+// `--rsh-max-pages` and `--rsh-max-items` limits are applied. Cancelling the
+// context stops fetching further pages without an error.
+func paginate(ctx context.Context, base *url.URL, resp *http.Response, fn pageFunc, options ...requestOption) error {
+	parsed, err := ParseResponse(resp)
+	if err != nil {
+		LogError("Parse response error")
+		return err
+	}
+
+	if viper.GetBool("rsh-no-paginate") {
+		return fn(parsed, nil)
+	}
+
+	pagination := getPagination(base, options)
+	maxPages := viper.GetInt("rsh-max-pages")
+	maxItems := viper.GetInt("rsh-max-items")
+
+	count := 0
+	limit := func(items []any) []any {
+		if maxItems > 0 && count+len(items) > maxItems {
+			items = items[:maxItems-count]
+		}
+		count += len(items)
+		return items
+	}
+
+	next, err := nextPage(base, parsed, pagination)
+	if err != nil {
+		return err
+	}
+
+	items, isList := pageItems(parsed, pagination, next != nil)
+	if isList {
+		items = limit(items)
+	} else {
+		items = nil
+	}
+	if err := fn(parsed, items); err != nil {
+		return err
+	}
+
+	for pages := 1; maxPages <= 0 || pages < maxPages; pages++ {
+		if maxItems > 0 && count >= maxItems {
+			break
+		}
+
+		if next == nil {
+			break
+		}
+
+		LogDebug("Found next page: %s", next)
+
+		if !isList {
+			LogWarning("Skipping auto-pagination: response body not a list, not sure how to merge")
+			break
+		}
+
+		if ctx.Err() != nil {
+			LogWarning("Interrupted, not fetching further pages")
+			break
+		}
+
+		// Make the next request
+		base = next
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, next.String(), nil)
+
+		resp, err = MakeRequest(req, options...)
+		if err != nil {
+			if ctx.Err() != nil {
+				LogWarning("Interrupted, not fetching further pages")
+				break
+			}
+			return err
+		}
+
+		parsed, err = ParseResponse(resp)
+		if err != nil {
+			return err
+		}
+
+		items, ok := pageItems(parsed, pagination, true)
+		if !ok {
+			LogWarning("Auto-pagination next page is not a list, aborting")
+			break
+		}
+
+		if err := fn(parsed, limit(items)); err != nil {
+			return err
+		}
+
+		if next, err = nextPage(base, parsed, pagination); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// streamPages formats the items in each page of a paginated response as soon
+// as the page arrives, rather than waiting for all pages to be merged. This
+// keeps memory use low for large collections. Interrupting the command, e.g.
+// with Ctrl-C, stops fetching further pages.
+func streamPages(base *url.URL, resp *http.Response, options ...requestOption) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return paginate(ctx, base, resp, func(page Response, items []any) error {
+		if items != nil {
+			page.Body = items
+			page.page = true
+		}
+		return Formatter.Format(page)
+	}, options...)
+}
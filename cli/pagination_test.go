@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestPaginationCursor(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	configs["cursor-test"] = &APIConfig{
+		name: "cursor-test",
+		Base: "http://cursor.example.com",
+		Pagination: &PaginationConfig{
+			Items:       "body.items",
+			Cursor:      "body.next_cursor",
+			CursorParam: "after",
+		},
+	}
+	defer delete(configs, "cursor-test")
+
+	gock.New("http://cursor.example.com").
+		Get("/items").
+		MatchParams(map[string]string{"limit": "2"}).
+		Reply(http.StatusOK).
+		JSON(map[string]any{"items": []any{1, 2}, "next_cursor": "abc"})
+	gock.New("http://cursor.example.com").
+		Get("/items").
+		MatchParams(map[string]string{"limit": "2", "after": "abc"}).
+		Reply(http.StatusOK).
+		JSON(map[string]any{"items": []any{3}, "next_cursor": nil})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://cursor.example.com/items?limit=2", nil)
+	resp, err := GetParsedResponse(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{1.0, 2.0, 3.0}, resp.Body)
+	assert.True(t, gock.IsDone())
+}
+
+func TestPaginationNextLink(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	gock.New("http://odata.example.com").
+		Get("/People").
+		Reply(http.StatusOK).
+		JSON(map[string]any{"value": []any{"a", "b"}, "@odata.nextLink": "/People?skip=2"})
+	gock.New("http://odata.example.com").
+		Get("/People").
+		MatchParam("skip", "2").
+		Reply(http.StatusOK).
+		JSON(map[string]any{"value": []any{"c"}})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://odata.example.com/People", nil)
+	resp, err := GetParsedResponse(req, WithPagination(&PaginationConfig{
+		Items: "body.value",
+		Next:  `body.@odata\.nextLink`,
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"a", "b", "c"}, resp.Body)
+}
+
+func TestPaginationLimits(t *testing.T) {
+	defer gock.Off()
+	defer viper.Set("rsh-max-pages", 0)
+	defer viper.Set("rsh-max-items", 0)
+
+	reset(false)
+	for i := 0; i < 2; i++ {
+		gock.New("http://limits.example.com").
+			Get("/items").
+			Reply(http.StatusOK).
+			SetHeader("Link", "</items>; rel=\"next\"").
+			JSON([]any{1, 2, 3})
+	}
+
+	viper.Set("rsh-max-pages", 2)
+	req, _ := http.NewRequest(http.MethodGet, "http://limits.example.com/items", nil)
+	resp, err := GetParsedResponse(req)
+	assert.NoError(t, err)
+	assert.Len(t, resp.Body, 6)
+	assert.True(t, gock.IsDone())
+
+	// Only the pages needed to get the items are fetched.
+	gock.New("http://limits.example.com").
+		Get("/items").
+		Times(2).
+		Reply(http.StatusOK).
+		SetHeader("Link", "</items>; rel=\"next\"").
+		JSON([]any{1, 2, 3})
+
+	viper.Set("rsh-max-pages", 0)
+	viper.Set("rsh-max-items", 4)
+	req, _ = http.NewRequest(http.MethodGet, "http://limits.example.com/items", nil)
+	resp, err = GetParsedResponse(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{1.0, 2.0, 3.0, 1.0}, resp.Body)
+	assert.True(t, gock.IsDone())
+}
+
+func TestPaginationNotList(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	// Without config, object bodies are not merged.
+	gock.New("http://object.example.com").
+		Get("/items").
+		Reply(http.StatusOK).
+		SetHeader("Link", "</items2>; rel=\"next\"").
+		JSON(map[string]any{"items": []any{1}})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://object.example.com/items", nil)
+	resp, err := GetParsedResponse(req)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"items": []any{1.0}}, resp.Body)
+}
+
+func TestPaginationSingleResource(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	configs["single-test"] = &APIConfig{
+		name: "single-test",
+		Base: "http://single.example.com",
+		Pagination: &PaginationConfig{
+			Items:  "body.items",
+			Cursor: "body.next_cursor",
+		},
+	}
+	defer delete(configs, "single-test")
+
+	// A single resource without items is left as-is rather than being treated
+	// as an empty page.
+	gock.New("http://single.example.com").
+		Get("/items/1").
+		Reply(http.StatusOK).
+		JSON(map[string]any{"id": 1})
+
+	req, _ := http.NewRequest(http.MethodGet, "http://single.example.com/items/1", nil)
+	resp, err := GetParsedResponse(req)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{"id": 1.0}, resp.Body)
+
+	// A first page which omits the items but has a cursor is an empty page.
+	gock.New("http://single.example.com").
+		Get("/items").
+		Reply(http.StatusOK).
+		JSON(map[string]any{"next_cursor": "abc"})
+	gock.New("http://single.example.com").
+		Get("/items").
+		MatchParam("cursor", "abc").
+		Reply(http.StatusOK).
+		JSON(map[string]any{"items": []any{1}})
+
+	req, _ = http.NewRequest(http.MethodGet, "http://single.example.com/items", nil)
+	resp, err = GetParsedResponse(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{1.0}, resp.Body)
+	assert.True(t, gock.IsDone())
+}
+
+func TestPaginationStream(t *testing.T) {
+	gock.Off()
+	reset(false)
+	defer reset(false)
+
+	capture := &strings.Builder{}
+	seen := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/items" {
+			w.Header().Set("Link", "</items2>; rel=\"next\"")
+			w.Write([]byte(`[{"id": 1, "name": "a"}, {"id": 2, "name": "b"}]`))
+			return
+		}
+		seen = capture.String()
+		w.Write([]byte(`[{"id": 3, "name": "c"}]`))
+	}))
+	defer server.Close()
+
+	Stdout = capture
+	viper.Set("rsh-stream", true)
+	viper.Set("rsh-filter", "body.id")
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/items", nil)
+	MakeRequestAndFormat(req)
+
+	// The first page was written before the second was requested, and the
+	// filter applies to each item.
+	assert.Equal(t, "1\n2\n", seen)
+	assert.Equal(t, "1\n2\n3\n", capture.String())
+
+	// Tables show each page's items as rows.
+	capture.Reset()
+	viper.Set("rsh-filter", "")
+	viper.Set("rsh-output-format", "table")
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/items", nil)
+	MakeRequestAndFormat(req)
+	assert.Equal(t, 2, strings.Count(capture.String(), "name"))
+	assert.Contains(t, capture.String(), "c")
+}
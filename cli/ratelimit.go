@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// rateLimitState is the persisted state of a rate limiter, so that limits
+// hold across separate invocations, e.g. when a script calls restish in a loop.
+type rateLimitState struct {
+	Tokens    float64    `json:"tokens"`
+	Updated   time.Time  `json:"updated"`
+	Remaining *int       `json:"remaining,omitempty"`
+	Reset     *time.Time `json:"reset,omitempty"`
+}
+
+// rateLimiter is a token bucket which also adapts to rate limit information
+// sent by the server.
+type rateLimiter struct {
+	mu    sync.Mutex
+	path  string
+	rate  float64
+	burst int
+}
+
+var rateLimitersMu sync.Mutex
+var rateLimiters = map[string]*rateLimiter{}
+
+// getRateLimiter returns the rate limiter for an API, or nil if the API has no
+// rate limit configured.
+func getRateLimiter(apiName string, config *RateLimitConfig) *rateLimiter {
+	if apiName == "" || config == nil {
+		return nil
+	}
+
+	rateLimitersMu.Lock()
+	defer rateLimitersMu.Unlock()
+
+	path := filepath.Join(viper.GetString("cache-dir"), "ratelimit", apiName+".json")
+	l := rateLimiters[path]
+	if l == nil {
+		l = &rateLimiter{path: path}
+		rateLimiters[path] = l
+	}
+	l.rate = config.Rate
+	l.burst = max(config.Burst, 1)
+
+	return l
+}
+
+// load the current state from disk. The lock must be held.
+func (l *rateLimiter) load(now time.Time) *rateLimitState {
+	state := &rateLimitState{}
+	if data, err := os.ReadFile(l.path); err == nil {
+		if json.Unmarshal(data, state) == nil {
+			return state
+		}
+		LogWarning("Ignoring invalid rate limit state %s", l.path)
+	}
+
+	return &rateLimitState{Tokens: float64(l.burst), Updated: now}
+}
+
+// save the state to disk atomically, so other restish processes never read
+// partial state. The lock must be held.
+func (l *rateLimiter) save(state *rateLimitState) {
+	data, err := json.Marshal(state)
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(l.path), 0700); err == nil {
+			err = writeFileAtomic(l.path, data)
+		}
+	}
+	if err != nil {
+		LogWarning("Unable to save rate limit state: %v", err)
+	}
+}
+
+// reserve a request at the given time, returning how long to wait before
+// making it.
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := l.load(now)
+	var wait time.Duration
+
+	if l.rate > 0 {
+		// Refill the bucket based on the time elapsed, then take a token. If none
+		// are available the balance goes negative, which reserves a future token
+		// so that later requests queue up behind this one.
+		elapsed := max(now.Sub(state.Updated).Seconds(), 0)
+		state.Tokens = min(float64(l.burst), state.Tokens+elapsed*l.rate) - 1
+		state.Updated = now
+		if state.Tokens < 0 {
+			wait = time.Duration(math.Ceil(-state.Tokens / l.rate * float64(time.Second)))
+		}
+	}
+
+	if state.Remaining != nil && state.Reset != nil {
+		if !now.Before(*state.Reset) {
+			// The server's window has passed, so the old info no longer applies.
+			state.Remaining, state.Reset = nil, nil
+		} else if *state.Remaining <= 0 {
+			// Pause until the window resets instead of waiting for a 429. The
+			// remaining count is unknown until the next response.
+			wait = max(wait, state.Reset.Sub(now))
+			state.Remaining, state.Reset = nil, nil
+		} else {
+			remaining := *state.Remaining - 1
+			state.Remaining = &remaining
+		}
+	}
+
+	l.save(state)
+
+	return wait
+}
+
+// Wait until a request can be made or the context is canceled.
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	wait := l.reserve(time.Now())
+	if wait <= 0 {
+		return nil
+	}
+
+	// Only mention short waits when debugging, but let users know why a
+	// request is taking longer than expected.
+	log := LogDebug
+	if wait >= time.Second {
+		log = LogInfo
+	}
+	log("Rate limit reached, waiting %s", wait.Truncate(time.Millisecond))
+	select {
+	case <-time.After(wait):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Update the limiter with any rate limit information in a response, using
+// either the `RateLimit-*` headers from the IETF draft or the common
+// `X-RateLimit-*` headers.
+func (l *rateLimiter) Update(resp *http.Response) {
+	remaining, reset, ok := parseRateLimitHeaders(resp.Header, time.Now())
+	if !ok {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	state := l.load(time.Now())
+	state.Remaining = &remaining
+	state.Reset = &reset
+	l.save(state)
+}
+
+// parseRateLimitHeaders returns the number of remaining requests and the time
+// at which the limit resets. The reset time may be given in seconds from now
+// or as a Unix timestamp.
+func parseRateLimitHeaders(header http.Header, now time.Time) (int, time.Time, bool) {
+	for _, prefix := range []string{"RateLimit-", "X-RateLimit-"} {
+		remaining, err := strconv.Atoi(header.Get(prefix + "Remaining"))
+		if err != nil {
+			continue
+		}
+
+		reset, err := strconv.ParseFloat(header.Get(prefix+"Reset"), 64)
+		if err != nil || reset < 0 {
+			continue
+		}
+
+		// Values this large can't be a delay, so must be a timestamp.
+		if reset > 1e9 {
+			return remaining, time.Unix(0, int64(reset*float64(time.Second))), true
+		}
+		return remaining, now.Add(time.Duration(reset * float64(time.Second))), true
+	}
+
+	return 0, time.Time{}, false
+}
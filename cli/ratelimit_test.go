@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestRateLimitTokenBucket(t *testing.T) {
+	l := &rateLimiter{path: filepath.Join(t.TempDir(), "test.json"), rate: 10, burst: 2}
+	now := time.Now()
+
+	// The burst is available immediately, then requests are spaced out.
+	assert.Equal(t, time.Duration(0), l.reserve(now))
+	assert.Equal(t, time.Duration(0), l.reserve(now))
+	assert.Equal(t, 100*time.Millisecond, l.reserve(now))
+	assert.Equal(t, 200*time.Millisecond, l.reserve(now))
+
+	// Tokens are refilled over time, up to the burst size.
+	assert.Equal(t, time.Duration(0), l.reserve(now.Add(time.Hour)))
+
+	// State is persisted, e.g. for the next invocation.
+	other := &rateLimiter{path: l.path, rate: 10, burst: 2}
+	assert.Equal(t, time.Duration(0), other.reserve(now.Add(time.Hour)))
+	assert.Equal(t, 100*time.Millisecond, other.reserve(now.Add(time.Hour)))
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	now := time.Now()
+
+	remaining, reset, ok := parseRateLimitHeaders(http.Header{
+		"Ratelimit-Remaining": {"5"},
+		"Ratelimit-Reset":     {"30"},
+	}, now)
+	assert.True(t, ok)
+	assert.Equal(t, 5, remaining)
+	assert.Equal(t, now.Add(30*time.Second), reset)
+
+	remaining, reset, ok = parseRateLimitHeaders(http.Header{
+		"X-Ratelimit-Remaining": {"0"},
+		"X-Ratelimit-Reset":     {"1700000000"},
+	}, now)
+	assert.True(t, ok)
+	assert.Equal(t, 0, remaining)
+	assert.Equal(t, time.Unix(1700000000, 0), reset)
+
+	_, _, ok = parseRateLimitHeaders(http.Header{
+		"X-Ratelimit-Remaining": {"10"},
+	}, now)
+	assert.False(t, ok)
+}
+
+func TestRateLimitAdaptive(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	viper.Set("cache-dir", t.TempDir())
+	defer delete(configs, "limited")
+	configs["limited"] = &APIConfig{
+		name:      "limited",
+		Base:      "http://limited.example.com",
+		RateLimit: &RateLimitConfig{},
+	}
+
+	gock.New("http://limited.example.com").
+		Get("/items").
+		Reply(http.StatusOK).
+		SetHeader("X-RateLimit-Remaining", "1").
+		SetHeader("X-RateLimit-Reset", "60")
+
+	req, _ := http.NewRequest(http.MethodGet, "http://limited.example.com/items", nil)
+	_, err := MakeRequest(req)
+	assert.NoError(t, err)
+
+	// One request remains, after which we must wait for the window to reset.
+	l := getRateLimiter("limited", configs["limited"].RateLimit)
+	now := time.Now()
+	assert.Equal(t, time.Duration(0), l.reserve(now))
+	assert.InDelta(t, 60*time.Second, l.reserve(now), float64(time.Second))
+}
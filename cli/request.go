@@ -8,11 +8,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/AlecAivazis/survey/v2"
@@ -25,12 +29,24 @@ import (
 // lastStatus is the last HTTP status code returned by a request.
 var lastStatus int
 
+// lastStatusMu guards `lastStatus` from concurrent requests.
+var lastStatusMu sync.Mutex
+
 // GetLastStatus returns the last HTTP status code returned by a request. A
 // request can opt out of this via the IgnoreStatus option.
 func GetLastStatus() int {
+	lastStatusMu.Lock()
+	defer lastStatusMu.Unlock()
 	return lastStatus
 }
 
+// setLastStatus sets the last HTTP status code returned by a request.
+func setLastStatus(status int) {
+	lastStatusMu.Lock()
+	defer lastStatusMu.Unlock()
+	lastStatus = status
+}
+
 // FixAddress can convert `:8000` or `example.com` to a full URL.
 func FixAddress(addr string) string {
 	return fixAddress(addr)
@@ -38,6 +54,11 @@ func FixAddress(addr string) string {
 
 // fixAddress can convert `:8000` or `example.com` to a full URL.
 func fixAddress(addr string) string {
+	if isSocketAddress(addr) {
+		// Unix domain socket or named pipe, e.g. `unix:///var/run/docker.sock:/`
+		return addr
+	}
+
 	if strings.HasPrefix(addr, ":") {
 		addr = "http://localhost" + addr
 	}
@@ -76,9 +97,13 @@ func fixAddress(addr string) string {
 
 type requestConfig struct {
 	client          *http.Client
+	noCache         bool
 	disableLog      bool
 	ignoreStatus    bool
 	ignoreCLIParams bool
+	pagination      *PaginationConfig
+	tls             *TLSConfig
+	auth            *APIAuth
 }
 
 type requestOption func(*requestConfig)
@@ -90,6 +115,14 @@ func WithClient(c *http.Client) requestOption {
 	}
 }
 
+// WithoutCache ignores any cached response for the request. Fresh responses
+// are still written to the cache.
+func WithoutCache() requestOption {
+	return func(conf *requestConfig) {
+		conf.noCache = true
+	}
+}
+
 // WithoutLog disabled debug logging for the given request/response.
 func WithoutLog() requestOption {
 	return func(conf *requestConfig) {
@@ -111,6 +144,29 @@ func IgnoreCLIParams() requestOption {
 	}
 }
 
+// WithPagination sets how to auto-paginate object responses, overriding the
+// API's pagination config. A nil config uses the API's config.
+func WithPagination(p *PaginationConfig) requestOption {
+	return func(conf *requestConfig) {
+		conf.pagination = p
+	}
+}
+
+// WithTLS sets TLS settings for the request, overriding those from the API
+// config. Only fields which are set are used. CLI flags still take precedence.
+func WithTLS(c *TLSConfig) requestOption {
+	return func(conf *requestConfig) {
+		conf.tls = c
+	}
+}
+
+// WithAuth sets the auth to use for the request instead of the profile's.
+func WithAuth(auth *APIAuth) requestOption {
+	return func(conf *requestConfig) {
+		conf.auth = auth
+	}
+}
+
 // MakeRequest makes an HTTP request using the default client. It adds the
 // user-agent, auth, and any passed headers or query params to the request
 // before sending it out on the wire. If verbose mode is enabled, it will
@@ -161,6 +217,16 @@ func MakeRequest(req *http.Request, options ...requestOption) (*http.Response, e
 				value = parts[1]
 			}
 
+			if strings.EqualFold(parts[0], "content-type") && req.Header.Get("content-type") != "" {
+				// The body's content type may include parameters, like a multipart
+				// boundary, so keep it if the media type is the same.
+				existing, _, _ := mime.ParseMediaType(req.Header.Get("content-type"))
+				passed, _, _ := mime.ParseMediaType(value)
+				if existing == passed {
+					continue
+				}
+			}
+
 			req.Header.Add(parts[0], value)
 		}
 
@@ -178,68 +244,112 @@ func MakeRequest(req *http.Request, options ...requestOption) (*http.Response, e
 	// Save modified query string arguments.
 	req.URL.RawQuery = query.Encode()
 
-	// The assumption is that all Transport implementations eventually use the
-	// default HTTP transport.
-	// We can therefore inject the TLS config once here, along with all the other
-	// config options, instead of modifying all the places where Transports are
-	// created
+	// Build the TLS settings for this request. The API config is copied so
+	// that CLI flags don't modify it for any other requests.
 	LogDebug("Adding TLS configuration")
-	if t, ok := http.DefaultTransport.(*http.Transport); ok {
-		if t.TLSClientConfig == nil {
-			t.TLSClientConfig = &tls.Config{}
-		}
-		if config.TLS == nil {
-			config.TLS = &TLSConfig{}
-		}
+	tlsConfig := TLSConfig{}
+	if config.TLS != nil {
+		tlsConfig = *config.TLS
+	}
 
-		// CLI flags overwrite profile options
-		if viper.GetBool("rsh-insecure") {
-			config.TLS.InsecureSkipVerify = true
+	if c := requestConf.tls; c != nil {
+		if c.InsecureSkipVerify {
+			tlsConfig.InsecureSkipVerify = true
 		}
-		if cert := viper.GetString("rsh-client-cert"); cert != "" {
-			config.TLS.Cert = cert
+		if c.Cert != "" {
+			tlsConfig.Cert = c.Cert
 		}
-		if key := viper.GetString("rsh-client-key"); key != "" {
-			config.TLS.Key = key
+		if c.Key != "" {
+			tlsConfig.Key = c.Key
 		}
-		if caCert := viper.GetString("rsh-ca-cert"); caCert != "" {
-			config.TLS.CACert = caCert
+		if c.CACert != "" {
+			tlsConfig.CACert = c.CACert
 		}
-
-		if config.TLS.InsecureSkipVerify {
-			LogWarning("Disabling TLS security checks")
-			t.TLSClientConfig.InsecureSkipVerify = config.TLS.InsecureSkipVerify
+		if c.PKCS11 != nil {
+			tlsConfig.PKCS11 = c.PKCS11
 		}
+	}
 
-		if config.TLS.PKCS11 != nil {
-			t.TLSClientConfig.GetClientCertificate = getCertFromPkcs11(config.TLS.PKCS11)
-		}
+	// CLI flags overwrite profile options
+	if viper.GetBool("rsh-insecure") {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if cert := viper.GetString("rsh-client-cert"); cert != "" {
+		tlsConfig.Cert = cert
+	}
+	if key := viper.GetString("rsh-client-key"); key != "" {
+		tlsConfig.Key = key
+	}
+	if caCert := viper.GetString("rsh-ca-cert"); caCert != "" {
+		tlsConfig.CACert = caCert
+	}
 
-		if config.TLS.Cert != "" {
-			cert, err := tls.LoadX509KeyPair(config.TLS.Cert, config.TLS.Key)
-			if err != nil {
-				return nil, err
-			}
-			t.TLSClientConfig.Certificates = append(t.TLSClientConfig.Certificates, cert)
+	if tlsConfig.InsecureSkipVerify {
+		LogWarning("Disabling TLS security checks")
+	}
+
+	// Profile proxy settings overwrite API settings, and CLI flags overwrite
+	// both.
+	proxy := config.Proxy
+	if profile.Proxy != nil {
+		proxy = profile.Proxy
+	}
+	if p := viper.GetString("rsh-proxy"); p != "" {
+		proxy = &ProxyConfig{URL: p}
+	}
+
+	// Requests can be sent over a Unix domain socket or named pipe, either via
+	// the API config or a `unix://` address.
+	socket := config.Socket
+	cacheSocket := ""
+	if s, u, ok := splitSocketURL(req.URL); ok {
+		socket = s
+		// Every socket URL becomes `http://localhost`, so the socket must be
+		// part of the cache key to keep responses from different sockets apart.
+		cacheSocket = s
+		req.URL = u
+		req.Host = ""
+	}
+
+	transport, err := getTransport(&tlsConfig, socket, proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	// Cassettes save exchanges to disk or serve them back without touching the
+	// network, e.g. for offline and deterministic runs in CI.
+	cassetteDir := viper.GetString("rsh-replay")
+	if cassetteDir != "" {
+		transport = &replayTransport{
+			cassette: getCassette(cassetteDir, viper.GetStringSlice("rsh-match-header")),
 		}
-		if config.TLS.CACert != "" {
-			caCert, err := os.ReadFile(config.TLS.CACert)
-			if err != nil {
-				return nil, err
-			}
-			systemCerts := BestEffortSystemCertPool()
-			if !systemCerts.AppendCertsFromPEM(caCert) {
-				return nil, fmt.Errorf("failed to append CACert %s RootCA list", config.TLS.CACert)
-			}
-			t.TLSClientConfig.RootCAs = systemCerts
+	} else if cassetteDir = viper.GetString("rsh-record"); cassetteDir != "" {
+		transport = &recordTransport{
+			cassette:  getCassette(cassetteDir, viper.GetStringSlice("rsh-match-header")),
+			transport: transport,
+		}
+	}
+
+	if path := viper.GetString("rsh-har"); path != "" {
+		// Record all exchanges, including e.g. auth token requests.
+		transport = &harTransport{
+			recorder:  getHARRecorder(path, viper.GetBool("rsh-har-unsafe")),
+			transport: transport,
 		}
 	}
 
+	// Make the transport available to auth handlers, e.g. for token requests.
+	req = req.WithContext(context.WithValue(req.Context(), transportContextKey{}, transport))
+
 	// Add auth if needed.
-	if profile.Auth != nil && profile.Auth.Name != "" {
-		auth, ok := authHandlers[profile.Auth.Name]
+	apiAuth := profile.Auth
+	if requestConf.auth != nil {
+		apiAuth = requestConf.auth
+	}
+	if apiAuth != nil && apiAuth.Name != "" {
+		auth, ok := authHandlers[apiAuth.Name]
 		if ok {
-			err := auth.OnRequest(req, name+":"+viper.GetString("rsh-profile"), profile.Auth.Params)
+			err := auth.OnRequest(req, name+":"+viper.GetString("rsh-profile"), apiAuth.Params)
 			if err != nil {
 				panic(err)
 			}
@@ -263,22 +373,79 @@ func MakeRequest(req *http.Request, options ...requestOption) (*http.Response, e
 		req.Header.Set("content-type", "application/json; charset=utf-8")
 	}
 
-	client := CachedTransport().Client()
-	if viper.GetBool("rsh-no-cache") {
-		client = &http.Client{Transport: InvalidateCachedTransport()}
+	// Compress the body if requested, with the CLI flag taking precedence.
+	compress := config.CompressBody
+	if c := viper.GetString("rsh-compress-body"); c != "" {
+		compress = c
+	}
+	if compress != "" && compress != "identity" {
+		if err := EncodeRequest(req, compress); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := cachedClient(name, config.Cache, cacheSocket, transport, viper.GetBool("rsh-no-cache") || requestConf.noCache)
+	if err != nil {
+		return nil, err
+	}
+
+	if cassetteDir != "" {
+		// Every exchange must be recorded and replayed, so skip the cache.
+		client = &http.Client{Transport: transport}
 	}
 
 	if requestConf.client != nil {
 		client = requestConf.client
 	}
 
-	resp, err := doRequestWithRetry(!requestConf.disableLog, client, req)
+	if config.Cookies && client.Jar == nil {
+		// Send & save cookies using the jar for this API profile. The client is
+		// copied so a custom client passed in is not modified.
+		jar, err := getCookieJar(name, viper.GetString("rsh-profile"))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load cookies: %w", err)
+		}
+		withJar := *client
+		withJar.Jar = jar
+		client = &withJar
+	}
+
+	export := viper.GetString("rsh-export")
+	if (viper.GetBool("rsh-dry-run") || export != "") && !requestConf.ignoreCLIParams {
+		// Show the request instead of sending it. Internal requests, e.g. to
+		// load API descriptions, ignore CLI params and are still sent so that
+		// commands can be built. Exported snippets must work, so they include
+		// secrets.
+		preview, err := previewRequest(client, req, export != "" || viper.GetBool("rsh-dry-run-unsafe"))
+		if err != nil {
+			return nil, err
+		}
+		if export != "" {
+			snippet, err := exportRequest(export, preview)
+			if err != nil {
+				return nil, err
+			}
+			Stdout.Write([]byte(snippet))
+		} else {
+			printDryRun(preview)
+		}
+		return nil, ErrDryRun
+	}
+
+	policy, err := getRetryPolicy(config, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter := getRateLimiter(name, config.RateLimit)
+
+	resp, err := doRequestWithRetry(!requestConf.disableLog, client, req, policy, limiter)
 	if err != nil {
 		return nil, err
 	}
 
 	if !requestConf.ignoreStatus {
-		lastStatus = resp.StatusCode
+		setLastStatus(resp.StatusCode)
 	}
 
 	return resp, nil
@@ -342,34 +509,24 @@ func getCertFromPkcs11(config *PKCS11Config) func(*tls.CertificateRequestInfo) (
 	return func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return &certificates[0], nil }
 }
 
-// isRetryable returns true if a request should be retried.
-func isRetryable(code int) bool {
-	if code == /* 408 */ http.StatusRequestTimeout ||
-		code == /*  425 */ http.StatusTooEarly ||
-		code == /*  429 */ http.StatusTooManyRequests ||
-		code == /*  500 */ http.StatusInternalServerError ||
-		code == /*  502 */ http.StatusBadGateway ||
-		code == /*  503 */ http.StatusServiceUnavailable ||
-		code == /*  504 */ http.StatusGatewayTimeout {
-		return true
-	}
-	return false
-}
-
 // doRequestWithRetry logs and makes a request, retrying as needed (if
-// configured) and returning the last response.
-func doRequestWithRetry(log bool, client *http.Client, req *http.Request) (*http.Response, error) {
-	retries := viper.GetInt("rsh-retry")
-
-	if retries == 0 {
-		return client.Do(req)
+// configured) and returning the last response. If a rate limiter is given,
+// each attempt waits for it and updates it from the response headers.
+func doRequestWithRetry(log bool, client *http.Client, req *http.Request, policy *retryPolicy, limiter *rateLimiter) (*http.Response, error) {
+	retries := policy.retries
+	if !policy.canRetry(req) {
+		retries = 0
 	}
 
+	// Buffer the body so it can be sent again, unless it can be re-created,
+	// e.g. for streamed multipart uploads.
 	var bodyContents []byte
-	if req.Body != nil {
+	if retries > 0 && req.Body != nil && req.GetBody == nil {
 		bodyContents, _ = io.ReadAll(req.Body)
 	}
 
+	req, info := withRetryInfo(req)
+
 	var resp *http.Response
 	var err error
 	triesLeft := 1 + retries
@@ -379,69 +536,101 @@ func doRequestWithRetry(log bool, client *http.Client, req *http.Request) (*http
 		if len(bodyContents) > 0 {
 			// Reset the body reader for each retry.
 			req.Body = io.NopCloser(bytes.NewReader(bodyContents))
+		} else if info.Count > 0 && req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				break
+			}
+		}
+
+		if limiter != nil {
+			if err = limiter.Wait(req.Context()); err != nil {
+				break
+			}
 		}
 
 		if log {
 			LogDebugRequest(req)
 		}
 
+		tryReq := req
 		if timeout := viper.GetDuration("rsh-timeout"); timeout > 0 {
 			ctx, cancel := context.WithTimeout(req.Context(), timeout)
 			defer cancel()
-			req = req.WithContext(ctx)
+			tryReq = req.WithContext(ctx)
 		}
 
+		tryReq = withTiming(tryReq)
 		start := time.Now()
-		resp, err = client.Do(req)
+		resp, err = client.Do(tryReq)
 		if err != nil {
-			if errors.Is(err, context.DeadlineExceeded) {
-				if triesLeft > 0 {
-					// Try again after letting the user know.
+			if triesLeft > 0 {
+				if errors.Is(err, context.DeadlineExceeded) {
+					// Try again immediately after letting the user know, since we have
+					// already waited for the timeout.
 					LogWarning("Got request timeout after %s, retrying", viper.GetDuration("rsh-timeout").Truncate(time.Millisecond))
+					info.Count++
+					continue
+				}
+
+				if policy.isRetryableError(err) {
+					wait := policy.delay(info.Count + 1)
+					LogWarning("Got %s, retrying in %s", err, wait.Truncate(time.Millisecond))
+					info.Count++
+					info.Wait += wait
+					time.Sleep(wait)
 					continue
-				} else {
-					// Add a human-friendly error before the original (context deadline
-					// exceeded).
-					err = fmt.Errorf("Request timed out after %s: %w", viper.GetDuration("rsh-timeout"), err)
 				}
 			}
-			return resp, err
+			break
 		}
 
 		if log {
 			LogDebugResponse(start, resp)
 		}
 
-		if triesLeft > 0 && isRetryable(resp.StatusCode) {
-			// Attempt to parse when to retry! Default is 1 second.
-			retryAfter := 1 * time.Second
-
-			if v := resp.Header.Get("Retry-After"); v != "" {
-				// Could be either an integer number of seconds, or an HTTP date.
-				if d, err := strconv.ParseInt(v, 10, 64); err == nil {
-					retryAfter = time.Duration(d) * time.Second
-				}
+		if limiter != nil {
+			limiter.Update(resp)
+		}
 
-				if d, err := http.ParseTime(v); err == nil {
-					retryAfter = time.Until(d)
-				}
+		if triesLeft > 0 && policy.isRetryableStatus(resp.StatusCode) {
+			// Prefer the server's requested delay, falling back to backoff.
+			wait, ok := retryAfter(resp)
+			if !ok {
+				wait = policy.delay(info.Count + 1)
 			}
 
-			if v := resp.Header.Get("X-Retry-In"); v != "" {
-				if d, err := time.ParseDuration(v); err == nil {
-					retryAfter = d
-				}
-			}
+			// Read the rest of the body so the connection can be reused.
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
 
-			LogWarning("Got %s, retrying in %s", resp.Status, retryAfter.Truncate(time.Millisecond))
-			time.Sleep(retryAfter)
+			LogWarning("Got %s, retrying in %s", resp.Status, wait.Truncate(time.Millisecond))
+			info.Count++
+			info.Wait += wait
+			time.Sleep(wait)
 
 			continue
 		}
 		break
 	}
 
-	return resp, err
+	if info.Count > 0 {
+		LogDebug("Retried %d times, waited %s total", info.Count, info.Wait.Truncate(time.Millisecond))
+	}
+
+	if err != nil {
+		return resp, timeoutError(err)
+	}
+
+	return resp, nil
+}
+
+// timeoutError adds a human-friendly error before the original (context
+// deadline exceeded) if the request timed out.
+func timeoutError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("Request timed out after %s: %w", viper.GetDuration("rsh-timeout"), err)
+	}
+	return err
 }
 
 // Response describes a parsed HTTP response which can be marshalled to enable
@@ -452,6 +641,21 @@ type Response struct {
 	Headers map[string]string `json:"headers"`
 	Links   Links             `json:"links"`
 	Body    interface{}       `json:"body"`
+
+	// Retries describes the retries needed to get this response, if any.
+	Retries *RetryInfo `json:"retries,omitempty"`
+
+	// Timing describes how long the request took, broken down by phase.
+	Timing *Timing `json:"timing,omitempty"`
+
+	// streamed is set for responses which are one of many parts of a single
+	// HTTP response, like server-sent events. These share the same status and
+	// headers so only the body is shown by default.
+	streamed bool
+
+	// page is set for responses whose body is a list of items from one page
+	// of a paginated response, which are each formatted as they arrive.
+	page bool
 }
 
 // Map returns a map representing this response matching the encoded JSON.
@@ -479,13 +683,73 @@ func (r Response) Map() map[string]any {
 		headers[k] = v
 	}
 
-	return map[string]any{
+	m := map[string]any{
 		"proto":   r.Proto,
 		"status":  r.Status,
 		"headers": headers,
 		"links":   links,
 		"body":    r.Body,
 	}
+
+	if r.Timing != nil {
+		m["timing"] = r.Timing.Map()
+	}
+
+	if r.Retries != nil {
+		m["retries"] = map[string]any{
+			"count": r.Retries.Count,
+			"wait":  r.Retries.Wait.String(),
+		}
+	}
+
+	return m
+}
+
+// joinHeaders converts multi-value HTTP headers into a simple map of header
+// name to value.
+func joinHeaders(header http.Header) map[string]string {
+	headers := map[string]string{}
+	for k, v := range header {
+		joiner := ", "
+		if k == "Set-Cookie" {
+			joiner = "\n"
+		}
+		headers[k] = strings.Join(v, joiner)
+	}
+	return headers
+}
+
+// isStreaming returns true if the response body should be processed
+// incrementally as it arrives rather than read all at once.
+func isStreaming(resp *http.Response) bool {
+	return isEventStream(resp) || getStreamUnmarshaller(resp.Header.Get("content-type")) != nil
+}
+
+// streamBody formats each value decoded from the response body as soon as it
+// arrives, avoiding the need to buffer the entire response in memory.
+func streamBody(resp *http.Response, su StreamUnmarshaller) error {
+	defer resp.Body.Close()
+	if err := DecodeResponse(resp); err != nil {
+		return err
+	}
+
+	if viper.GetBool("rsh-raw") && viper.GetString("rsh-filter") == "" {
+		// Raw mode without filtering, don't parse the response.
+		_, err := io.Copy(Stdout, resp.Body)
+		return err
+	}
+
+	headers := joinHeaders(resp.Header)
+	return su.UnmarshalStream(resp.Body, func(value any) error {
+		return Formatter.Format(Response{
+			Proto:    resp.Proto,
+			Status:   resp.StatusCode,
+			Headers:  headers,
+			Links:    Links{},
+			Body:     value,
+			streamed: true,
+		})
+	})
 }
 
 // ParseResponse takes an HTTP response and tries to parse it using the
@@ -501,6 +765,11 @@ func ParseResponse(resp *http.Response) (Response, error) {
 
 	data, _ := io.ReadAll(resp.Body)
 
+	timing := getTiming(resp)
+	if timing != nil {
+		timing.finish()
+	}
+
 	if len(data) > 0 {
 		if viper.GetBool("rsh-raw") && viper.GetString("rsh-filter") == "" {
 			// Raw mode without filtering, don't parse the response.
@@ -514,21 +783,14 @@ func ParseResponse(resp *http.Response) (Response, error) {
 	}
 
 	// Wrap the body to describe the entire response
-	headers := map[string]string{}
 	output := Response{
 		Proto:   resp.Proto,
 		Status:  resp.StatusCode,
-		Headers: headers,
+		Headers: joinHeaders(resp.Header),
 		Links:   Links{},
 		Body:    parsed,
-	}
-
-	for k, v := range resp.Header {
-		joiner := ", "
-		if k == "Set-Cookie" {
-			joiner = "\n"
-		}
-		headers[k] = strings.Join(v, joiner)
+		Retries: getRetryInfo(resp),
+		Timing:  timing,
 	}
 
 	if err := ParseLinks(resp.Request.URL, &output); err != nil {
@@ -543,83 +805,74 @@ func ParseResponse(resp *http.Response) (Response, error) {
 // handles any auto-pagination or linking that needs to be done and may
 // return a psuedo-responsse that is a combination of all responses.
 func GetParsedResponse(req *http.Request, options ...requestOption) (Response, error) {
+	// Keep the URL as it was before profile & CLI params were added, so that
+	// cursors can be added to it for the next page.
+	orig := *req.URL
+
 	resp, err := MakeRequest(req, options...)
 	if err != nil {
 		return Response{}, err
 	}
 
-	parsed, err := ParseResponse(resp)
-	if err != nil {
-		LogError("Parse response error")
-		return Response{}, err
-	}
+	return parsePaginated(&orig, resp, options...)
+}
 
+// parsePaginated parses the response to a request that has already been made,
+// fetching and merging any further pages as needed.
+func parsePaginated(base *url.URL, resp *http.Response, options ...requestOption) (Response, error) {
+	var parsed Response
+	var items []any
+	allLinks := Links{}
+	timings := []*Timing{}
 	computedSize := int64(0)
-	if s, err := strconv.ParseInt(parsed.Headers["Content-Length"], 10, 64); err == nil {
-		computedSize = s
-	}
-
-	base := req.URL
-	allLinks := parsed.Links
-	for {
-		links := parsed.Links
-		if len(links["next"]) == 0 || viper.GetBool("rsh-no-paginate") {
-			break
-		}
-
-		LogDebug("Found pagination via rel=next link: %s", links["next"][0].URI)
 
-		if _, ok := parsed.Body.([]interface{}); !ok {
-			// TODO: support non-list formats like JSON:API
-			LogWarning("Skipping auto-pagination: response body not a list, not sure how to merge")
-			break
-		}
-
-		// Make the next request
-		next, _ := url.Parse(links["next"][0].URI)
-		next = base.ResolveReference(next)
-		req, _ = http.NewRequest(http.MethodGet, next.String(), nil)
-
-		resp, err = MakeRequest(req, options...)
-		if err != nil {
-			return Response{}, err
-		}
-
-		// Merge the responses
-		parsedNext, err := ParseResponse(resp)
-		if err != nil {
-			return Response{}, err
-		}
-
-		if l, ok := parsedNext.Body.([]interface{}); ok {
+	err := paginate(context.Background(), base, resp, func(page Response, pageItems []any) error {
+		if len(timings) == 0 {
+			parsed = page
+			allLinks = page.Links
+			if pageItems != nil {
+				items = make([]any, 0, len(pageItems))
+			}
+		} else {
 			// The last request in the chain will be the one that gets displayed
 			// for the proto/status/headers, plus the merged body/links.
-			parsed.Proto = parsedNext.Proto
-			parsed.Status = parsedNext.Status
-			parsed.Headers = parsedNext.Headers
-			parsed.Links = parsedNext.Links
-			parsed.Body = append(parsed.Body.([]interface{}), l...)
+			parsed.Proto = page.Proto
+			parsed.Status = page.Status
+			parsed.Headers = page.Headers
 
-			for name, links := range parsedNext.Links {
+			for name, links := range page.Links {
 				allLinks[name] = append(allLinks[name], links...)
 			}
+		}
+		items = append(items, pageItems...)
+		timings = append(timings, page.Timing)
 
-			// Update the total computed size to include the size of each individual
-			// request if the content size is available.
-			if s, err := strconv.ParseInt(parsedNext.Headers["Content-Length"], 10, 64); err == nil {
-				computedSize += s
-			}
-		} else {
-			LogWarning("Auto-pagination next page is not a list, aborting")
-			break
+		// Update the total computed size to include the size of each individual
+		// request if the content size is available.
+		if s, err := strconv.ParseInt(page.Headers["Content-Length"], 10, 64); err == nil {
+			computedSize += s
 		}
+		return nil
+	}, options...)
+	if err != nil {
+		return Response{}, err
+	}
+
+	if items != nil {
+		parsed.Body = items
 	}
 
 	// Set the final response links as a combination of all.
 	parsed.Links = allLinks
 
-	if computedSize > 0 {
-		parsed.Headers["Content-Length"] = fmt.Sprintf("%d", computedSize)
+	if len(timings) > 1 {
+		if !slices.Contains(timings, nil) {
+			parsed.Timing = combineTimings(timings)
+		}
+
+		if computedSize > 0 {
+			parsed.Headers["Content-Length"] = fmt.Sprintf("%d", computedSize)
+		}
 	}
 
 	return parsed, nil
@@ -627,14 +880,70 @@ func GetParsedResponse(req *http.Request, options ...requestOption) (Response, e
 
 // MakeRequestAndFormat is a convenience function for calling `GetParsedResponse`
 // and then calling the default formatter's `Format` function with the parsed
-// response. Panics on error.
-func MakeRequestAndFormat(req *http.Request) {
-	parsed, err := GetParsedResponse(req)
+// response. Server-sent event streams and other streaming formats like JSON
+// lines are formatted one item at a time as they arrive. Panics on error.
+func MakeRequestAndFormat(req *http.Request, options ...requestOption) {
+	if output := viper.GetString("rsh-output-file"); output != "" {
+		MakeRequestAndDownload(req, output)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+	req = req.WithContext(ctx)
+
+	// Keep a copy of the request as it was before any modifications in case it
+	// needs to be sent again, e.g. to resume an interrupted event stream.
+	orig := req.Clone(ctx)
+
+	resp, err := MakeRequest(req, options...)
 	if err != nil {
 		panic(err)
 	}
 
-	if err := Formatter.Format(parsed); err != nil {
+	streamed := isEventStream(resp) || getStreamUnmarshaller(resp.Header.Get("content-type")) != nil || viper.GetBool("rsh-stream")
+	if streamed {
+		// The body is never fully read into memory, so only the status and
+		// headers can be checked.
+		checkExpectations(Response{
+			Proto:   resp.Proto,
+			Status:  resp.StatusCode,
+			Headers: joinHeaders(resp.Header),
+		}, false)
+
+		// Streams may never end, so stop reading on Ctrl-C and close the body
+		// as usual. This lets e.g. HAR files keep what was received so far.
+		interrupt, stop := signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+		go func() {
+			<-interrupt.Done()
+			cancel()
+		}()
+	}
+
+	if isEventStream(resp) {
+		err = streamEvents(orig, resp, options...)
+	} else if su := getStreamUnmarshaller(resp.Header.Get("content-type")); su != nil {
+		err = streamBody(resp, su)
+	} else if viper.GetBool("rsh-stream") {
+		err = streamPages(orig.URL, resp, options...)
+	} else {
+		var parsed Response
+		parsed, err = parsePaginated(orig.URL, resp, options...)
+		if err != nil {
+			panic(err)
+		}
+		if err = Formatter.Format(parsed); err == nil {
+			checkExpectations(parsed, true)
+		}
+	}
+
+	if err != nil && streamed && ctx.Err() != nil {
+		// The stream was stopped on purpose.
+		return
+	}
+
+	if err != nil {
 		if e, ok := err.(shorthand.Error); ok {
 			panic(e.Pretty())
 		}
@@ -206,3 +206,28 @@ func TestRequestRetryTimeout(t *testing.T) {
 	assert.Error(t, err)
 	assert.ErrorContains(t, err, "timed out")
 }
+
+func TestStreamJSONLines(t *testing.T) {
+	defer gock.Off()
+
+	gock.New("http://example.com").
+		Get("/items").
+		Reply(http.StatusOK).
+		SetHeader("Content-Type", "application/x-ndjson").
+		BodyString("{\"id\": 1}\n\n{\"id\": 2}\n")
+
+	captured := run("-f body.id http://example.com/items")
+	assert.Equal(t, "1\n2\n", captured)
+}
+
+func TestOutputJSONLines(t *testing.T) {
+	defer gock.Off()
+
+	gock.New("http://example.com").
+		Get("/items").
+		Reply(http.StatusOK).
+		JSON([]any{map[string]any{"id": 1}, map[string]any{"id": 2}})
+
+	captured := run("-o jsonl -f body http://example.com/items")
+	assert.Equal(t, "{\"id\":1}\n{\"id\":2}\n", captured)
+}
@@ -0,0 +1,287 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultRetryStatusCodes are the response status codes which are retried
+// unless configured otherwise.
+var defaultRetryStatusCodes = []int{
+	http.StatusRequestTimeout,      // 408
+	http.StatusTooEarly,            // 425
+	http.StatusTooManyRequests,     // 429
+	http.StatusInternalServerError, // 500
+	http.StatusBadGateway,          // 502
+	http.StatusServiceUnavailable,  // 503
+	http.StatusGatewayTimeout,      // 504
+}
+
+// retryPolicy is the resolved set of retry settings for a single request.
+type retryPolicy struct {
+	retries       int
+	backoff       time.Duration
+	maxDelay      time.Duration
+	multiplier    float64
+	jitter        float64
+	statusCodes   []int
+	networkErrors bool
+	allMethods    bool
+}
+
+// getRetryPolicy resolves the retry policy for a request. The global config
+// (including environment variables) provides defaults, which are overridden
+// by the API and then the profile config. Arguments explicitly passed on the
+// commandline override everything.
+func getRetryPolicy(config *APIConfig, profile *APIProfile) (*retryPolicy, error) {
+	p := &retryPolicy{
+		multiplier:    2,
+		jitter:        0.2,
+		networkErrors: true,
+	}
+
+	if err := p.applyGlobal(false); err != nil {
+		return nil, err
+	}
+
+	if err := p.apply(config.Retry); err != nil {
+		return nil, err
+	}
+
+	if err := p.apply(profile.Retry); err != nil {
+		return nil, err
+	}
+
+	if err := p.applyGlobal(true); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// applyGlobal applies the global retry settings. If `changedOnly` is set, then
+// only flags explicitly passed on the commandline are applied.
+func (p *retryPolicy) applyGlobal(changedOnly bool) error {
+	use := func(name string) bool {
+		return !changedOnly || (GlobalFlags != nil && GlobalFlags.Changed(name))
+	}
+
+	if use("rsh-retry") {
+		p.retries = viper.GetInt("rsh-retry")
+	}
+
+	if use("rsh-retry-backoff") {
+		p.backoff = viper.GetDuration("rsh-retry-backoff")
+	}
+
+	if use("rsh-retry-max-delay") {
+		p.maxDelay = viper.GetDuration("rsh-retry-max-delay")
+	}
+
+	if use("rsh-retry-all-methods") {
+		p.allMethods = viper.GetBool("rsh-retry-all-methods")
+	}
+
+	if use("rsh-retry-status") {
+		codes := defaultRetryStatusCodes
+		if values := viper.GetStringSlice("rsh-retry-status"); len(values) > 0 {
+			codes = []int{}
+			for _, v := range values {
+				code, err := strconv.Atoi(v)
+				if err != nil {
+					return fmt.Errorf("invalid retry status code %s: %w", v, err)
+				}
+				codes = append(codes, code)
+			}
+		}
+		p.statusCodes = codes
+	}
+
+	return nil
+}
+
+// apply overrides the policy with any values set in the config.
+func (p *retryPolicy) apply(c *RetryConfig) error {
+	if c == nil {
+		return nil
+	}
+
+	if c.Retries != nil {
+		p.retries = *c.Retries
+	}
+
+	if c.Backoff != "" {
+		d, err := time.ParseDuration(c.Backoff)
+		if err != nil {
+			return fmt.Errorf("invalid retry backoff: %w", err)
+		}
+		p.backoff = d
+	}
+
+	if c.MaxDelay != "" {
+		d, err := time.ParseDuration(c.MaxDelay)
+		if err != nil {
+			return fmt.Errorf("invalid retry max delay: %w", err)
+		}
+		p.maxDelay = d
+	}
+
+	if c.Multiplier != 0 {
+		p.multiplier = c.Multiplier
+	}
+
+	if c.Jitter != nil {
+		p.jitter = *c.Jitter
+	}
+
+	if c.StatusCodes != nil {
+		p.statusCodes = c.StatusCodes
+	}
+
+	if c.NetworkErrors != nil {
+		p.networkErrors = *c.NetworkErrors
+	}
+
+	if c.AllMethods != nil {
+		p.allMethods = *c.AllMethods
+	}
+
+	return nil
+}
+
+// canRetry returns true if the request may safely be retried. Non-idempotent
+// methods like `POST` are only retried when an `Idempotency-Key` header is
+// present or the policy allows all methods.
+func (p *retryPolicy) canRetry(req *http.Request) bool {
+	if p.allMethods || req.Header.Get("Idempotency-Key") != "" {
+		return true
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+
+	return false
+}
+
+// isRetryableStatus returns true if a response with the given status code
+// should be retried.
+func (p *retryPolicy) isRetryableStatus(code int) bool {
+	for _, c := range p.statusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// isRetryableError returns true if a failed request should be retried, e.g.
+// because the connection was reset or a DNS lookup failed.
+func (p *retryPolicy) isRetryableError(err error) bool {
+	if !p.networkErrors {
+		return false
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		// A host which does not exist won't start existing by trying again.
+		return !dnsErr.IsNotFound
+	}
+
+	return false
+}
+
+// delay returns how long to wait before the given retry attempt (starting at
+// one) using exponential backoff with jitter.
+func (p *retryPolicy) delay(attempt int) time.Duration {
+	d := float64(p.backoff) * math.Pow(p.multiplier, float64(attempt-1))
+
+	if p.jitter > 0 {
+		d *= 1 + p.jitter*(2*rand.Float64()-1)
+	}
+
+	if p.maxDelay > 0 && d > float64(p.maxDelay) {
+		d = float64(p.maxDelay)
+	}
+
+	return time.Duration(d)
+}
+
+// retryAfter returns the server-requested delay before retrying, if any.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if v := resp.Header.Get("X-Retry-In"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			return d, true
+		}
+	}
+
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		// Could be either an integer number of seconds, or an HTTP date.
+		if d, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Duration(d) * time.Second, true
+		}
+
+		if d, err := http.ParseTime(v); err == nil {
+			// Dates in the past mean retry immediately.
+			return max(time.Until(d), 0), true
+		}
+	}
+
+	return 0, false
+}
+
+// RetryInfo describes the retries needed to get a response.
+type RetryInfo struct {
+	Count int           `json:"count"`
+	Wait  time.Duration `json:"wait"`
+}
+
+// MarshalJSON encodes the wait as a duration string like `1.5s`, matching the
+// response map used for output.
+func (r RetryInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"count": r.Count,
+		"wait":  r.Wait.String(),
+	})
+}
+
+type retryInfoContextKey struct{}
+
+// getRetryInfo returns the retry information for a response, or nil if the
+// request was not retried.
+func getRetryInfo(resp *http.Response) *RetryInfo {
+	if resp.Request == nil {
+		return nil
+	}
+
+	if info, ok := resp.Request.Context().Value(retryInfoContextKey{}).(*RetryInfo); ok && info.Count > 0 {
+		return info
+	}
+
+	return nil
+}
+
+// withRetryInfo returns a copy of the request which tracks retry information.
+func withRetryInfo(req *http.Request) (*http.Request, *RetryInfo) {
+	info := &RetryInfo{}
+	return req.WithContext(context.WithValue(req.Context(), retryInfoContextKey{}, info)), info
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestRetryPolicyConfig(t *testing.T) {
+	reset(false)
+	viper.Set("rsh-retry", 2)
+
+	retries := 5
+	jitter := 0.0
+	networkErrors := false
+	config := &APIConfig{
+		Retry: &RetryConfig{
+			Retries:     &retries,
+			Backoff:     "100ms",
+			MaxDelay:    "300ms",
+			Jitter:      &jitter,
+			StatusCodes: []int{503},
+		},
+	}
+	profile := &APIProfile{
+		Retry: &RetryConfig{
+			NetworkErrors: &networkErrors,
+		},
+	}
+
+	p, err := getRetryPolicy(config, profile)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, p.retries)
+	assert.False(t, p.networkErrors)
+	assert.True(t, p.isRetryableStatus(503))
+	assert.False(t, p.isRetryableStatus(429))
+
+	// Exponential backoff up to the max delay.
+	assert.Equal(t, 100*time.Millisecond, p.delay(1))
+	assert.Equal(t, 200*time.Millisecond, p.delay(2))
+	assert.Equal(t, 300*time.Millisecond, p.delay(3))
+	assert.Equal(t, 300*time.Millisecond, p.delay(4))
+
+	// Jitter stays within bounds.
+	p.jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := p.delay(1)
+		assert.GreaterOrEqual(t, d, 50*time.Millisecond)
+		assert.LessOrEqual(t, d, 150*time.Millisecond)
+	}
+
+	// Defaults come from the global config.
+	p, err = getRetryPolicy(&APIConfig{}, &APIProfile{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, p.retries)
+	assert.Equal(t, 1*time.Second, p.backoff)
+	assert.True(t, p.isRetryableStatus(429))
+
+	_, err = getRetryPolicy(&APIConfig{Retry: &RetryConfig{Backoff: "bad"}}, &APIProfile{})
+	assert.Error(t, err)
+}
+
+func TestRetryIdempotency(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	viper.Set("rsh-retry", 1)
+	viper.Set("rsh-retry-backoff", time.Millisecond)
+
+	// Non-idempotent methods are not retried by default.
+	gock.New("http://example.com").
+		Post("/").
+		Times(1).
+		Reply(http.StatusServiceUnavailable)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://example.com/", bytes.NewReader([]byte("hello")))
+	resp, err := MakeRequest(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.True(t, gock.IsDone())
+
+	// With an idempotency key they can be retried.
+	gock.New("http://example.com").
+		Post("/").
+		Times(1).
+		Reply(http.StatusServiceUnavailable)
+
+	gock.New("http://example.com").
+		Post("/").
+		BodyString("hello").
+		Times(1).
+		Reply(http.StatusOK)
+
+	req, _ = http.NewRequest(http.MethodPost, "http://example.com/", bytes.NewReader([]byte("hello")))
+	req.Header.Set("Idempotency-Key", "abc123")
+	resp, err = MakeRequest(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	parsed, err := ParseResponse(resp)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, parsed.Retries.Count)
+	assert.Equal(t, 1, parsed.Map()["retries"].(map[string]any)["count"])
+}
+
+func TestRetryNetworkError(t *testing.T) {
+	defer gock.Off()
+
+	reset(false)
+	viper.Set("rsh-retry", 1)
+	viper.Set("rsh-retry-backoff", time.Millisecond)
+
+	gock.New("http://example.com").
+		Get("/").
+		Times(1).
+		ReplyError(&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET})
+
+	gock.New("http://example.com").
+		Get("/").
+		Times(1).
+		Reply(http.StatusOK)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	resp, err := MakeRequest(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// DNS lookups for hosts which don't exist are not retried.
+	p := &retryPolicy{networkErrors: true}
+	assert.False(t, p.isRetryableError(&net.DNSError{Err: "no such host", IsNotFound: true}))
+	assert.True(t, p.isRetryableError(&net.DNSError{Err: "server misbehaving", IsTemporary: true}))
+}
+
+func TestRetryInfoJSON(t *testing.T) {
+	resp := Response{Retries: &RetryInfo{Count: 2, Wait: 1500 * time.Millisecond}}
+
+	// The JSON encoding matches the response map used for output.
+	b, err := json.Marshal(resp.Retries)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"count": 2, "wait": "1.5s"}`, string(b))
+
+	expected, _ := json.Marshal(resp.Map()["retries"])
+	assert.JSONEq(t, string(expected), string(b))
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// isSocketAddress returns true if the address is a Unix domain socket or
+// named pipe address like `unix:///var/run/docker.sock:/v1.43/info`.
+func isSocketAddress(addr string) bool {
+	return strings.HasPrefix(addr, "unix://") || strings.HasPrefix(addr, "npipe://")
+}
+
+// socketPathEscaper percent-encodes characters in a socket path which would
+// otherwise end it early in a socket URL.
+var socketPathEscaper = strings.NewReplacer("%", "%25", ":", "%3A", "?", "%3F", "#", "%23")
+
+// splitSocketURL splits a socket URL like
+// `unix:///var/run/docker.sock:/v1.43/info` into the socket path and the
+// HTTP URL to request over that socket. The first colon ends the socket path,
+// so any colons within it must be percent-encoded as `%3A`. Returns false if
+// the URL is not a socket URL.
+func splitSocketURL(u *url.URL) (string, *url.URL, bool) {
+	if u.Scheme != "unix" && u.Scheme != "npipe" {
+		return "", nil, false
+	}
+
+	socket, rawPath, _ := strings.Cut(u.Host+u.EscapedPath(), ":")
+	if s, err := url.PathUnescape(socket); err == nil {
+		socket = s
+	}
+	if rawPath == "" {
+		rawPath = "/"
+	}
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		path = rawPath
+	}
+
+	return socket, &url.URL{
+		Scheme:   "http",
+		Host:     "localhost",
+		Path:     path,
+		RawPath:  rawPath,
+		RawQuery: u.RawQuery,
+	}, true
+}
+
+// socketURL returns the socket address for a URL split from it by
+// `splitSocketURL`, e.g. `unix:///var/run/docker.sock:/v1.43/info`.
+func socketURL(socket string, u *url.URL) string {
+	scheme := "unix"
+	if isNamedPipe(socket) {
+		scheme = "npipe"
+	}
+
+	s := scheme + "://" + socketPathEscaper.Replace(socket) + ":" + u.EscapedPath()
+	if u.RawQuery != "" {
+		s += "?" + u.RawQuery
+	}
+	return s
+}
+
+// isNamedPipe returns true if the socket path refers to a Windows named pipe.
+func isNamedPipe(socket string) bool {
+	return strings.HasPrefix(socket, `\\.\pipe\`) || strings.HasPrefix(socket, "//./pipe/")
+}
+
+// dialSocket connects to a Unix domain socket or Windows named pipe.
+func dialSocket(ctx context.Context, socket string) (net.Conn, error) {
+	if isNamedPipe(socket) {
+		return dialPipe(ctx, strings.ReplaceAll(socket, "/", `\`))
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, "unix", socket)
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package cli
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// dialPipe is only supported on Windows.
+func dialPipe(ctx context.Context, path string) (net.Conn, error) {
+	return nil, errors.New("named pipes are only supported on Windows")
+}
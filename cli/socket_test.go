@@ -0,0 +1,135 @@
+package cli
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestSplitSocketURL(t *testing.T) {
+	u, _ := url.Parse("unix:///var/run/docker.sock:/v1.43/containers/json?all=true")
+	socket, httpURL, ok := splitSocketURL(u)
+	assert.True(t, ok)
+	assert.Equal(t, "/var/run/docker.sock", socket)
+	assert.Equal(t, "http://localhost/v1.43/containers/json?all=true", httpURL.String())
+	assert.Equal(t, "unix:///var/run/docker.sock:/v1.43/containers/json?all=true", socketURL(socket, httpURL))
+
+	u, _ = url.Parse("npipe:////./pipe/docker_engine")
+	socket, httpURL, ok = splitSocketURL(u)
+	assert.True(t, ok)
+	assert.True(t, isNamedPipe(socket))
+	assert.Equal(t, "http://localhost/", httpURL.String())
+	assert.Equal(t, "npipe:////./pipe/docker_engine:/", socketURL(socket, httpURL))
+
+	// Colons in the socket path are percent-encoded.
+	u, _ = url.Parse("unix:///tmp/a%3Ab.sock:/v1/items%2F1:2?q=a:b")
+	socket, httpURL, ok = splitSocketURL(u)
+	assert.True(t, ok)
+	assert.Equal(t, "/tmp/a:b.sock", socket)
+	assert.Equal(t, "/v1/items/1:2", httpURL.Path)
+	assert.Equal(t, "http://localhost/v1/items%2F1:2?q=a:b", httpURL.String())
+	assert.Equal(t, "unix:///tmp/a%3Ab.sock:/v1/items%2F1:2?q=a:b", socketURL(socket, httpURL))
+
+	u, _ = url.Parse("https://example.com/foo")
+	_, _, ok = splitSocketURL(u)
+	assert.False(t, ok)
+}
+
+func TestUnixSocket(t *testing.T) {
+	gock.Off()
+	reset(false)
+
+	socket := filepath.Join(t.TempDir(), "test.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip("unix sockets not supported:", err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path": "` + r.URL.Path + `", "auth": "` + r.Header.Get("Authorization") + `"}`))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	// Ad-hoc socket address.
+	captured := runNoReset("-o json -f body unix://" + socket + ":/v1/info")
+	assert.JSONEq(t, `{"path": "/v1/info", "auth": ""}`, captured)
+
+	// Colons in the socket path must be percent-encoded.
+	dir := filepath.Join(t.TempDir(), "a:b")
+	os.Mkdir(dir, 0700)
+	assert.NoError(t, os.Rename(socket, filepath.Join(dir, "test.sock")))
+	socket = filepath.Join(dir, "test.sock")
+	captured = runNoReset("-o json -f body unix://" + strings.ReplaceAll(socket, ":", "%3A") + ":/v1/info")
+	assert.JSONEq(t, `{"path": "/v1/info", "auth": ""}`, captured)
+
+	// Per-API socket configuration, including profile auth.
+	AddAuth("test-auth", &TestAuth{})
+	configs["socket-test"] = &APIConfig{
+		name:   "socket-test",
+		Base:   "http://socket-test",
+		Socket: socket,
+		Profiles: map[string]*APIProfile{
+			"default": {
+				Auth: &APIAuth{Name: "test-auth"},
+			},
+		},
+	}
+	defer delete(configs, "socket-test")
+
+	captured = runNoReset("-o json -f body socket-test/v1/items")
+	assert.JSONEq(t, `{"path": "/v1/items", "auth": "abc123"}`, captured)
+}
+
+func TestUnixSocketCache(t *testing.T) {
+	gock.Off()
+	reset(false)
+	viper.Set("cache-dir", t.TempDir())
+
+	sockets := []string{}
+	for _, name := range []string{"a", "b"} {
+		socket := filepath.Join(t.TempDir(), name+".sock")
+		listener, err := net.Listen("unix", socket)
+		if err != nil {
+			t.Skip("unix sockets not supported:", err)
+		}
+
+		server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"server": "` + name + `"}`))
+		})}
+		go server.Serve(listener)
+		defer server.Close()
+		sockets = append(sockets, socket)
+	}
+
+	// Both sockets serve the same path, but their cached responses must not
+	// be shared.
+	for i := 0; i < 2; i++ {
+		captured := runNoReset("-o json -f body unix://" + sockets[0] + ":/info")
+		assert.JSONEq(t, `{"server": "a"}`, captured)
+		captured = runNoReset("-o json -f body unix://" + sockets[1] + ":/info")
+		assert.JSONEq(t, `{"server": "b"}`, captured)
+	}
+
+	entries, err := listCache("")
+	assert.NoError(t, err)
+	urls := []string{}
+	for _, e := range entries {
+		urls = append(urls, e.URL)
+	}
+	assert.ElementsMatch(t, []string{
+		"unix://" + sockets[0] + ":/info",
+		"unix://" + sockets[1] + ":/info",
+	}, urls)
+}
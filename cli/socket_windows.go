@@ -0,0 +1,15 @@
+package cli
+
+import (
+	"context"
+	"net"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// dialPipe connects to a Windows named pipe like `\\.\pipe\docker_engine`.
+// The pipe is opened for overlapped I/O, so reads and writes can happen
+// concurrently and deadlines work as `http.Transport` expects.
+func dialPipe(ctx context.Context, path string) (net.Conn, error) {
+	return winio.DialPipeContext(ctx, path)
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Microsoft/go-winio"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestNamedPipe(t *testing.T) {
+	gock.Off()
+	reset(false)
+
+	pipe := fmt.Sprintf(`\\.\pipe\restish-test-%d`, time.Now().UnixNano())
+	listener, err := winio.ListenPipe(pipe, nil)
+	if err != nil {
+		t.Skip("named pipes not supported:", err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path": "` + r.URL.Path + `"}`))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	// Multiple requests reuse the connection, which needs concurrent reads &
+	// writes on the pipe.
+	for i := 0; i < 3; i++ {
+		captured := runNoReset("-o json -f body npipe:////./pipe/" + pipe[len(`\\.\pipe\`):] + ":/v1/info")
+		assert.JSONEq(t, `{"path": "/v1/info"}`, captured)
+	}
+}
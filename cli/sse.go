@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// defaultEventRetry is the reconnection delay used for event streams when the
+// server has not sent a `retry` field.
+const defaultEventRetry = 1 * time.Second
+
+// ServerSentEvent describes a single event from a `text/event-stream`
+// response. See https://html.spec.whatwg.org/multipage/server-sent-events.html
+type ServerSentEvent struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+// contentType returns the content type of the event's data. Events have no
+// standard way to declare this, so an event type which is a media type like
+// `application/yaml` is used if present. Otherwise, data which looks like
+// JSON is treated as JSON.
+func (e ServerSentEvent) contentType() string {
+	if mt, _, err := mime.ParseMediaType(e.Event); err == nil && strings.Contains(mt, "/") {
+		return e.Event
+	}
+
+	if trimmed := strings.TrimSpace(e.Data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return "application/json"
+	}
+
+	return ""
+}
+
+// Map returns a map representing this event suitable for filtering and
+// formatting. Structured data is decoded using the registered content types.
+func (e ServerSentEvent) Map() map[string]any {
+	m := map[string]any{
+		"event": e.Event,
+	}
+
+	if e.ID != "" {
+		m["id"] = e.ID
+	}
+
+	if e.Retry > 0 {
+		m["retry"] = e.Retry.Milliseconds()
+	}
+
+	var data any = e.Data
+	if ct := e.contentType(); ct != "" {
+		var decoded any
+		if err := Unmarshal(ct, []byte(e.Data), &decoded); err == nil {
+			data = makeJSONSafe(decoded)
+		}
+	}
+	m["data"] = data
+
+	return m
+}
+
+// isEventStream returns true if the response is a server-sent event stream.
+func isEventStream(resp *http.Response) bool {
+	return strings.HasPrefix(strings.ToLower(resp.Header.Get("content-type")), "text/event-stream")
+}
+
+// readEvents parses server-sent events from the reader, calling the handler
+// for each complete event as soon as it has been received. The `id` field
+// carries over between events as described in the spec, so `lastID` should
+// be set to the last known event ID when resuming a stream. A clean end of the
+// stream returns a nil error.
+func readEvents(r io.Reader, lastID string, handler func(ServerSentEvent) error) error {
+	reader := bufio.NewReader(r)
+	event := ServerSentEvent{ID: lastID}
+	data := &strings.Builder{}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				// Any partial event is discarded, per the spec.
+				return nil
+			}
+			return err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			// Blank line, dispatch the event if there is one.
+			if data.Len() > 0 {
+				event.Data = strings.TrimSuffix(data.String(), "\n")
+				if event.Event == "" {
+					event.Event = "message"
+				}
+				if err := handler(event); err != nil {
+					return err
+				}
+			}
+			event = ServerSentEvent{ID: event.ID}
+			data.Reset()
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			// Comment, usually used as a keep-alive.
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "event":
+			event.Event = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				event.ID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 64); err == nil {
+				event.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// streamEvents formats each server-sent event from the response as soon as it
+// arrives. If the connection drops, the original request is re-sent with the
+// `Last-Event-ID` header set, up to `rsh-retry` times in a row.
+func streamEvents(orig *http.Request, resp *http.Response, options ...requestOption) error {
+	lastID := ""
+	retry := defaultEventRetry
+	attempts := 0
+
+	for {
+		body := resp.Body
+		if err := DecodeResponse(resp); err != nil {
+			body.Close()
+			return err
+		}
+
+		var formatErr error
+		err := readEvents(resp.Body, lastID, func(e ServerSentEvent) error {
+			lastID = e.ID
+			if e.Retry > 0 {
+				retry = e.Retry
+			}
+			attempts = 0
+
+			formatErr = Formatter.Format(Response{
+				Proto:    resp.Proto,
+				Status:   resp.StatusCode,
+				Headers:  joinHeaders(resp.Header),
+				Links:    Links{},
+				Body:     e.Map(),
+				streamed: true,
+			})
+			return formatErr
+		})
+		body.Close()
+
+		if formatErr != nil {
+			return formatErr
+		}
+
+		if err == nil {
+			// The server closed the stream, we are done.
+			return nil
+		}
+
+		if orig.Context().Err() != nil || attempts >= viper.GetInt("rsh-retry") {
+			return err
+		}
+		attempts++
+
+		LogWarning("Event stream interrupted (%v), reconnecting in %s", err, retry.Truncate(time.Millisecond))
+		time.Sleep(retry)
+
+		req := orig.Clone(orig.Context())
+		if orig.GetBody != nil {
+			if req.Body, err = orig.GetBody(); err != nil {
+				return err
+			}
+		}
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+
+		resp, err = MakeRequest(req, options...)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode == http.StatusNoContent {
+			// The server is telling us to stop reconnecting.
+			resp.Body.Close()
+			return nil
+		}
+
+		if resp.StatusCode != http.StatusOK || !isEventStream(resp) {
+			parsed, err := ParseResponse(resp)
+			if err != nil {
+				return err
+			}
+			// The stream can't be resumed, so show the reason why. The exit code
+			// will reflect the response status.
+			return Formatter.Format(parsed)
+		}
+	}
+}
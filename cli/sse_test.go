@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestReadEvents(t *testing.T) {
+	reset(false)
+
+	stream := ": keep-alive\n" +
+		"id: 1\n" +
+		"event: progress\n" +
+		"data: {\"percent\": 50}\n" +
+		"\n" +
+		"data: line one\r\n" +
+		"data: line two\r\n" +
+		"retry: 500\r\n" +
+		"\r\n" +
+		"data: incomplete"
+
+	events := []ServerSentEvent{}
+	err := readEvents(strings.NewReader(stream), "", func(e ServerSentEvent) error {
+		events = append(events, e)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []ServerSentEvent{
+		{ID: "1", Event: "progress", Data: "{\"percent\": 50}"},
+		{ID: "1", Event: "message", Data: "line one\nline two", Retry: 500 * time.Millisecond},
+	}, events)
+
+	assert.Equal(t, map[string]any{
+		"id":    "1",
+		"event": "progress",
+		"data":  map[string]any{"percent": 50.0},
+	}, events[0].Map())
+
+	// Data is decoded using the event type if it is a media type.
+	assert.Equal(t, map[string]any{
+		"event": "application/yaml",
+		"data":  map[string]any{"percent": 50},
+	}, ServerSentEvent{Event: "application/yaml", Data: "percent: 50"}.Map())
+
+	assert.Equal(t, map[string]any{
+		"event": "text/plain",
+		"data":  "[not json]",
+	}, ServerSentEvent{Event: "text/plain", Data: "[not json]"}.Map())
+}
+
+func TestEventStreamOutput(t *testing.T) {
+	defer gock.Off()
+
+	gock.New("http://example.com").
+		Get("/events").
+		Reply(http.StatusOK).
+		SetHeader("Content-Type", "text/event-stream").
+		BodyString("data: {\"id\": 1}\n\ndata: {\"id\": 2}\n\n")
+
+	captured := run("-f body.data.id http://example.com/events")
+	assert.Equal(t, "1\n2\n", captured)
+}
+
+// brokenStream returns some data and then fails as if the connection dropped.
+type brokenStream struct {
+	io.Reader
+}
+
+func (b *brokenStream) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err == io.EOF {
+		err = errors.New("connection reset")
+	}
+	return n, err
+}
+
+type eventTransport struct {
+	requests []*http.Request
+}
+
+func (e *eventTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e.requests = append(e.requests, req)
+
+	var body io.Reader = strings.NewReader("data: done\n\n")
+	if len(e.requests) == 1 {
+		body = &brokenStream{strings.NewReader("id: 1\nretry: 1\ndata: started\n\n")}
+	}
+
+	return &http.Response{
+		Proto:      "HTTP/1.1",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body:       io.NopCloser(body),
+		Request:    req,
+	}, nil
+}
+
+func TestEventStreamReconnect(t *testing.T) {
+	reset(false)
+	viper.Set("rsh-retry", 1)
+	viper.Set("rsh-filter", "body.data")
+	viper.Set("rsh-raw", true)
+
+	buf := &bytes.Buffer{}
+	Stdout = buf
+	Stderr = io.Discard
+
+	transport := &eventTransport{}
+	client := &http.Client{Transport: transport}
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/events", nil)
+	orig := req.Clone(req.Context())
+	resp, err := MakeRequest(req, WithClient(client))
+	assert.NoError(t, err)
+
+	err = streamEvents(orig, resp, WithClient(client))
+	assert.NoError(t, err)
+
+	assert.Len(t, transport.requests, 2)
+	assert.Equal(t, "1", transport.requests[1].Header.Get("Last-Event-ID"))
+	assert.Equal(t, "started\ndone\n", buf.String())
+}
@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timing describes how long each phase of a request took. Phases which did
+// not happen, e.g. DNS lookups and connecting when reusing a connection, are
+// zero. For auto-paginated responses, the phases are summed across all pages
+// and the per-page breakdown is available in `Pages`.
+type Timing struct {
+	DNS       time.Duration `json:"dns"`
+	Connect   time.Duration `json:"connect"`
+	TLS       time.Duration `json:"tls"`
+	FirstByte time.Duration `json:"first_byte"`
+	Total     time.Duration `json:"total"`
+	Reused    bool          `json:"reused"`
+	Pages     []*Timing     `json:"pages,omitempty"`
+
+	mu           sync.Mutex
+	start        time.Time
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+}
+
+// trace returns an HTTP client trace which records timing information.
+func (t *Timing) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.DNS = time.Since(t.dnsStart)
+		},
+		ConnectStart: func(network, addr string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if err == nil && t.Connect == 0 {
+				t.Connect = time.Since(t.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.TLS = time.Since(t.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.Reused = info.Reused
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.FirstByte = time.Since(t.start)
+		},
+	}
+}
+
+// finish records the total time once the response has been read.
+func (t *Timing) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.Total = time.Since(t.start)
+}
+
+// Map returns a map representation of the timing information with
+// human-readable durations.
+func (t *Timing) Map() map[string]any {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	m := map[string]any{
+		"dns":        formatDuration(t.DNS),
+		"connect":    formatDuration(t.Connect),
+		"tls":        formatDuration(t.TLS),
+		"first_byte": formatDuration(t.FirstByte),
+		"total":      formatDuration(t.Total),
+		"reused":     t.Reused,
+	}
+
+	if len(t.Pages) > 0 {
+		pages := make([]any, len(t.Pages))
+		for i, p := range t.Pages {
+			pages[i] = p.Map()
+		}
+		m["pages"] = pages
+	}
+
+	return m
+}
+
+// String returns a short single-line summary of the timing information.
+func (t *Timing) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	parts := []string{}
+	if t.DNS > 0 {
+		parts = append(parts, "dns "+formatDuration(t.DNS))
+	}
+	if t.Connect > 0 {
+		parts = append(parts, "connect "+formatDuration(t.Connect))
+	}
+	if t.TLS > 0 {
+		parts = append(parts, "tls "+formatDuration(t.TLS))
+	}
+	if t.FirstByte > 0 {
+		parts = append(parts, "first byte "+formatDuration(t.FirstByte))
+	}
+	if t.Total > 0 {
+		parts = append(parts, "total "+formatDuration(t.Total))
+	}
+	if len(t.Pages) > 0 {
+		parts = append(parts, fmt.Sprintf("%d pages", len(t.Pages)))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// formatDuration rounds a duration to make it easier to read.
+func formatDuration(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
+
+// combineTimings sums the timing of multiple pages of a single logical
+// response, keeping the per-page breakdown.
+func combineTimings(pages []*Timing) *Timing {
+	combined := &Timing{Pages: pages}
+	for _, p := range pages {
+		p.mu.Lock()
+		combined.DNS += p.DNS
+		combined.Connect += p.Connect
+		combined.TLS += p.TLS
+		combined.FirstByte += p.FirstByte
+		combined.Total += p.Total
+		p.mu.Unlock()
+	}
+	return combined
+}
+
+type timingContextKey struct{}
+
+// withTiming returns a copy of the request which records timing information
+// for the request from now on.
+func withTiming(req *http.Request) *http.Request {
+	t := &Timing{start: time.Now()}
+	ctx := context.WithValue(req.Context(), timingContextKey{}, t)
+	return req.WithContext(httptrace.WithClientTrace(ctx, t.trace()))
+}
+
+// getTiming returns the timing information for a response, if available.
+func getTiming(resp *http.Response) *Timing {
+	if resp.Request == nil {
+		return nil
+	}
+
+	t, _ := resp.Request.Context().Value(timingContextKey{}).(*Timing)
+	return t
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestTiming(t *testing.T) {
+	gock.Off()
+	reset(false)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/items" {
+			w.Header().Set("Link", "</items2>; rel=\"next\"")
+		}
+		w.Write([]byte(`[1, 2]`))
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/single", nil)
+	parsed, err := GetParsedResponse(req)
+	assert.NoError(t, err)
+	if assert.NotNil(t, parsed.Timing) {
+		assert.Greater(t, parsed.Timing.FirstByte, time.Duration(0))
+		assert.GreaterOrEqual(t, parsed.Timing.Total, parsed.Timing.FirstByte)
+		assert.Empty(t, parsed.Timing.Pages)
+		assert.Contains(t, parsed.Map(), "timing")
+	}
+
+	// Paginated responses have a per-page breakdown.
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/items", nil)
+	parsed, err = GetParsedResponse(req)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{1.0, 2.0, 1.0, 2.0}, parsed.Body)
+	if assert.NotNil(t, parsed.Timing) && assert.Len(t, parsed.Timing.Pages, 2) {
+		assert.Equal(t, parsed.Timing.Pages[0].Total+parsed.Timing.Pages[1].Total, parsed.Timing.Total)
+		assert.Len(t, parsed.Timing.Map()["pages"], 2)
+	}
+
+	// Filtering the timing info.
+	captured := runNoReset("-f timing.reused " + server.URL + "/single")
+	assert.Contains(t, captured, "true")
+
+	// Showing it in the default output.
+	captured = run("--rsh-timing " + server.URL + "/single")
+	assert.Contains(t, captured, "Timing: ")
+	assert.Contains(t, captured, "first byte ")
+}
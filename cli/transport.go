@@ -1,17 +1,178 @@
 package cli
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
-	"path/filepath"
+	"net/url"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gbl08ma/httpcache"
-	"github.com/gbl08ma/httpcache/diskcache"
+	"golang.org/x/net/http/httpproxy"
 )
 
+// transportKey describes the settings used to build an HTTP transport, and is
+// used to share transports (and their connection pools) between requests.
+type transportKey struct {
+	insecure    bool
+	cert        string
+	key         string
+	caCert      string
+	pkcs11Path  string
+	pkcs11Label string
+	socket      string
+	proxy       string
+	proxyUser   string
+	proxyPass   string
+	noProxy     string
+}
+
+var transportsMu sync.Mutex
+var transports = map[transportKey]*http.Transport{}
+
+// getTransport returns an HTTP transport for the given TLS settings, optional
+// Unix domain socket or named pipe, and optional proxy. Each unique set of
+// settings gets its own isolated transport, so settings for one API never leak
+// into requests for another. A nil proxy means the proxy environment variables
+// are used.
+func getTransport(config *TLSConfig, socket string, proxy *ProxyConfig) (http.RoundTripper, error) {
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		// The default transport has been replaced, e.g. by a mocking library in
+		// tests, so use it as-is.
+		return http.DefaultTransport, nil
+	}
+
+	key := transportKey{
+		insecure: config.InsecureSkipVerify,
+		cert:     config.Cert,
+		key:      config.Key,
+		caCert:   config.CACert,
+		socket:   socket,
+	}
+	if config.PKCS11 != nil {
+		key.pkcs11Path = config.PKCS11.Path
+		key.pkcs11Label = config.PKCS11.Label
+	}
+	if proxy != nil {
+		key.proxy = proxy.URL
+		key.proxyUser = proxy.Username
+		key.proxyPass = proxy.Password
+		key.noProxy = strings.Join(proxy.NoProxy, ",")
+	}
+
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+
+	if t := transports[key]; t != nil {
+		return t, nil
+	}
+
+	t := base.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+
+	if proxy != nil {
+		f, err := proxyFunc(proxy)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = f
+	}
+
+	if socket != "" {
+		// Always connect to the socket, regardless of the requested host. Proxies
+		// make no sense for local sockets.
+		t.Proxy = nil
+		t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialSocket(ctx, socket)
+		}
+	}
+
+	t.TLSClientConfig.InsecureSkipVerify = config.InsecureSkipVerify
+
+	if config.PKCS11 != nil {
+		t.TLSClientConfig.GetClientCertificate = getCertFromPkcs11(config.PKCS11)
+	}
+
+	if config.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig.Certificates = append(t.TLSClientConfig.Certificates, cert)
+	}
+
+	if config.CACert != "" {
+		caCert, err := os.ReadFile(config.CACert)
+		if err != nil {
+			return nil, err
+		}
+		systemCerts := BestEffortSystemCertPool()
+		if !systemCerts.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("failed to append CACert %s RootCA list", config.CACert)
+		}
+		t.TLSClientConfig.RootCAs = systemCerts
+	}
+
+	transports[key] = t
+	return t, nil
+}
+
+// proxyFunc returns a function which selects the proxy to use for each
+// request, taking the no-proxy list into account. The special URL `direct`
+// disables proxying, including via environment variables.
+func proxyFunc(config *ProxyConfig) (func(*http.Request) (*url.URL, error), error) {
+	if config.URL == "" || config.URL == "direct" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL %s: %w", config.URL, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %s, expected one of http, https, socks5", u.Scheme)
+	}
+
+	if config.Username != "" {
+		u.User = url.UserPassword(os.ExpandEnv(config.Username), os.ExpandEnv(config.Password))
+	}
+
+	selector := (&httpproxy.Config{
+		HTTPProxy:  u.String(),
+		HTTPSProxy: u.String(),
+		NoProxy:    strings.Join(config.NoProxy, ","),
+	}).ProxyFunc()
+
+	return func(req *http.Request) (*url.URL, error) {
+		return selector(req.URL)
+	}, nil
+}
+
+type transportContextKey struct{}
+
+// ClientFromContext returns an HTTP client that uses the same transport as
+// the request being made. This is available to auth handlers via the request
+// context so that e.g. token requests use the same TLS settings as the API.
+// Defaults to `http.DefaultClient`.
+func ClientFromContext(ctx context.Context) *http.Client {
+	if t, ok := ctx.Value(transportContextKey{}).(http.RoundTripper); ok {
+		return &http.Client{Transport: t}
+	}
+	return http.DefaultClient
+}
+
 // cacheKey returns the cache key for req.
 func cacheKey(req *http.Request) string {
 	if req.Method == http.MethodGet {
@@ -44,17 +205,35 @@ func shouldCache(resp *http.Response) bool {
 
 // CachedTransport returns an HTTP transport with caching abilities.
 func CachedTransport() *httpcache.Transport {
-	t := httpcache.NewTransport(diskcache.New(filepath.Join(getCacheDir(), "responses")))
+	return newCachedTransport(&responseCache{dir: responseCacheDir("")}, nil, 0)
+}
+
+// newCachedTransport returns an HTTP transport which stores responses in the
+// given cache, wrapping `transport` or `http.DefaultTransport` if nil. A
+// minimum cache duration is applied to responses without cache headers if
+// `min` is set.
+func newCachedTransport(cache *responseCache, transport http.RoundTripper, min time.Duration) *httpcache.Transport {
+	t := httpcache.NewTransport(cache)
+	t.Transport = transport
 	t.MarkCachedResponses = false
+	if min > 0 {
+		t.Transport = &minCachedTransport{min, transport}
+	}
 	return t
 }
 
 type minCachedTransport struct {
-	min time.Duration
+	min       time.Duration
+	transport http.RoundTripper
 }
 
 func (m minCachedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	resp, err := http.DefaultClient.Do(req)
+	transport := m.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(req)
 	if err != nil {
 		return nil, err
 	}
@@ -84,9 +263,7 @@ func (m minCachedTransport) RoundTrip(req *http.Request) (*http.Response, error)
 // MinCachedTransport returns an HTTP transport with caching abilities and
 // a minimum cache duration for any responses if no cache headers are set.
 func MinCachedTransport(min time.Duration) *httpcache.Transport {
-	t := CachedTransport()
-	t.Transport = &minCachedTransport{min}
-	return t
+	return newCachedTransport(&responseCache{dir: responseCacheDir("")}, nil, min)
 }
 
 type invalidateCachedTransport struct {
@@ -1,7 +1,10 @@
 package cli
 
 import (
+	"io"
+	"log"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -61,3 +64,108 @@ func TestMinCachedTransport(t *testing.T) {
 	assert.Equal(t, resp.StatusCode, 400)
 	assert.Equal(t, resp.Header.Get("cache-control"), "")
 }
+
+func TestTransportIsolation(t *testing.T) {
+	gock.Off()
+	reset(false)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	insecure, err := getTransport(&TLSConfig{InsecureSkipVerify: true}, "", nil)
+	assert.NoError(t, err)
+
+	again, err := getTransport(&TLSConfig{InsecureSkipVerify: true}, "", nil)
+	assert.NoError(t, err)
+	assert.Same(t, insecure, again)
+
+	secure, err := getTransport(&TLSConfig{}, "", nil)
+	assert.NoError(t, err)
+	assert.NotSame(t, insecure, secure)
+
+	// Insecure settings for one API must not leak into other requests.
+	configs["tls-test"] = &APIConfig{
+		Base: server.URL + "/insecure",
+		TLS:  &TLSConfig{InsecureSkipVerify: true},
+		Profiles: map[string]*APIProfile{
+			"default": {},
+		},
+	}
+	defer delete(configs, "tls-test")
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/insecure", nil)
+	resp, err := MakeRequest(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/secure", nil)
+	_, err = MakeRequest(req)
+	assert.Error(t, err)
+
+	tc := http.DefaultTransport.(*http.Transport).TLSClientConfig
+	assert.True(t, tc == nil || !tc.InsecureSkipVerify)
+}
+
+func TestProxyFunc(t *testing.T) {
+	f, err := proxyFunc(&ProxyConfig{
+		URL:     "socks5://proxy.internal:1080",
+		NoProxy: []string{"public.example.com", ".cdn.example.com"},
+	})
+	assert.NoError(t, err)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://api.internal/items", nil)
+	u, err := f(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "socks5://proxy.internal:1080", u.String())
+
+	for _, addr := range []string{"https://public.example.com/", "https://img.cdn.example.com/"} {
+		req, _ = http.NewRequest(http.MethodGet, addr, nil)
+		u, err = f(req)
+		assert.NoError(t, err)
+		assert.Nil(t, u, addr)
+	}
+
+	f, err = proxyFunc(&ProxyConfig{URL: "direct"})
+	assert.NoError(t, err)
+	assert.Nil(t, f)
+
+	_, err = proxyFunc(&ProxyConfig{URL: "ftp://proxy.internal"})
+	assert.Error(t, err)
+}
+
+func TestProxy(t *testing.T) {
+	gock.Off()
+	reset(false)
+
+	// Acts as a forward proxy, echoing back what it received.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"url": "` + r.URL.String() + `", "auth": "` + r.Header.Get("Proxy-Authorization") + `"}`))
+	}))
+	defer proxy.Close()
+
+	configs["proxied"] = &APIConfig{
+		name: "proxied",
+		Base: "http://proxied.example.com",
+		Proxy: &ProxyConfig{
+			URL:      proxy.URL,
+			Username: "user",
+			Password: "pass",
+		},
+		Profiles: map[string]*APIProfile{
+			"default": {},
+		},
+	}
+	defer delete(configs, "proxied")
+
+	captured := runNoReset("-o json -f body proxied/items")
+	assert.JSONEq(t, `{"url": "http://proxied.example.com/items", "auth": "Basic dXNlcjpwYXNz"}`, captured)
+
+	// The CLI flag overrides the config.
+	captured = runNoReset("-o json -f body --rsh-proxy " + proxy.URL + " http://other.example.com/items")
+	assert.JSONEq(t, `{"url": "http://other.example.com/items", "auth": ""}`, captured)
+}
@@ -0,0 +1,488 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danielgtaylor/shorthand/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Workflow describes a series of requests to make in order. Values can be
+// extracted from each response and used in later steps as `${name}`, or as
+// `vars.name` in expectations. Environment variables are available as
+// `${env.NAME}` and `env.NAME`.
+type Workflow struct {
+	Name  string         `json:"name,omitempty" yaml:"name,omitempty"`
+	Vars  map[string]any `json:"vars,omitempty" yaml:"vars,omitempty"`
+	Steps []WorkflowStep `json:"steps" yaml:"steps"`
+}
+
+// WorkflowStep describes one request in a workflow. `Extract` maps variable
+// names to shorthand queries against the response, e.g. `id: body.id`, and
+// `Expect` is a list of mexpr expressions which must all be true.
+type WorkflowStep struct {
+	Name    string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Method  string            `json:"method,omitempty" yaml:"method,omitempty"`
+	URI     string            `json:"uri" yaml:"uri"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body    any               `json:"body,omitempty" yaml:"body,omitempty"`
+	Extract map[string]string `json:"extract,omitempty" yaml:"extract,omitempty"`
+	Expect  []string          `json:"expect,omitempty" yaml:"expect,omitempty"`
+}
+
+// WorkflowResult describes the outcome of one workflow step.
+type WorkflowResult struct {
+	Name     string
+	Method   string
+	URI      string
+	Status   int
+	Duration time.Duration
+	Failures []string
+	Error    string
+	Skipped  bool
+}
+
+// Passed returns whether the step ran successfully.
+func (r WorkflowResult) Passed() bool {
+	return !r.Skipped && r.Error == "" && len(r.Failures) == 0
+}
+
+// workflowVarPattern matches variable references like `${id}` or
+// `${env.TOKEN}`.
+var workflowVarPattern = regexp.MustCompile(`\$\{((?:env\.)?\w+)\}`)
+
+// readWorkflow reads a workflow from YAML or JSON.
+func readWorkflow(r io.Reader) (*Workflow, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var wf Workflow
+	if err := yaml.Unmarshal(data, &wf); err != nil {
+		return nil, fmt.Errorf("invalid workflow: %w", err)
+	}
+	if len(wf.Steps) == 0 {
+		return nil, errors.New("workflow has no steps")
+	}
+	for i, step := range wf.Steps {
+		if step.URI == "" {
+			return nil, fmt.Errorf("workflow step %d has no uri", i+1)
+		}
+	}
+
+	return &wf, nil
+}
+
+// lookupVar returns the value of a workflow variable. Names starting with
+// `env.` are read from the environment so secrets need not be stored in the
+// workflow file.
+func lookupVar(vars map[string]any, name string) (any, error) {
+	if envName, ok := strings.CutPrefix(name, "env."); ok {
+		if v, ok := os.LookupEnv(envName); ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("undefined environment variable %s", envName)
+	}
+	if v, ok := vars[name]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("undefined variable %s", name)
+}
+
+// workflowEnv returns the environment as a map for use in expectations.
+func workflowEnv() map[string]any {
+	env := map[string]any{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// expandVars substitutes variables within a string. Values which are not
+// strings are encoded as JSON, e.g. `1` or `["a","b"]`.
+func expandVars(s string, vars map[string]any) (string, error) {
+	var err error
+	expanded := workflowVarPattern.ReplaceAllStringFunc(s, func(match string) string {
+		v, lookupErr := lookupVar(vars, match[2:len(match)-1])
+		if lookupErr != nil {
+			err = lookupErr
+			return match
+		}
+		if str, ok := v.(string); ok {
+			return str
+		}
+		encoded, _ := json.Marshal(makeJSONSafe(v))
+		return string(encoded)
+	})
+	return expanded, err
+}
+
+// expandValue substitutes variables within a structured body. A string
+// which is only a variable reference is replaced by the variable's value,
+// keeping its type.
+func expandValue(v any, vars map[string]any) (any, error) {
+	switch t := v.(type) {
+	case string:
+		if m := workflowVarPattern.FindStringSubmatch(t); m != nil && m[0] == t {
+			return lookupVar(vars, m[1])
+		}
+		return expandVars(t, vars)
+	case []any:
+		expanded := make([]any, len(t))
+		for i, item := range t {
+			value, err := expandValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			expanded[i] = value
+		}
+		return expanded, nil
+	case map[string]any:
+		expanded := make(map[string]any, len(t))
+		for k, item := range t {
+			value, err := expandValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			expanded[k] = value
+		}
+		return expanded, nil
+	}
+	return v, nil
+}
+
+// expandStep returns the request to make for a step with all variables
+// substituted.
+func expandStep(step WorkflowStep, vars map[string]any) (BatchRequest, error) {
+	br := BatchRequest{
+		Name:   step.Name,
+		Method: step.Method,
+	}
+
+	var err error
+	if br.URI, err = expandVars(step.URI, vars); err != nil {
+		return br, err
+	}
+
+	if len(step.Headers) > 0 {
+		br.Headers = map[string]string{}
+		for name, value := range step.Headers {
+			if br.Headers[name], err = expandVars(value, vars); err != nil {
+				return br, err
+			}
+		}
+	}
+
+	if br.Body, err = expandValue(step.Body, vars); err != nil {
+		return br, err
+	}
+
+	return br, nil
+}
+
+// runWorkflowStep makes the request for a step, then extracts variables and
+// checks expectations against the response. Without any expectations, a
+// step fails if the response status is 400 or above.
+func runWorkflowStep(ctx context.Context, step WorkflowStep, vars map[string]any) (result WorkflowResult) {
+	result = WorkflowResult{
+		Name:   step.Name,
+		Method: strings.ToUpper(step.Method),
+		URI:    step.URI,
+	}
+
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			result.Error = fmt.Sprintf("%v", err)
+		}
+		result.Duration = time.Since(start)
+	}()
+
+	br, err := expandStep(step, vars)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	req, err := newBatchRequest(ctx, br)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	result.Method = req.Method
+	result.URI = req.URL.String()
+	if result.Name == "" {
+		result.Name = req.Method + " " + result.URI
+	}
+
+	resp, err := MakeRequest(req, IgnoreStatus())
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+
+	parsed, err := ParseResponse(resp)
+	if err != nil {
+		result.Error = err.Error()
+		return
+	}
+	result.Status = parsed.Status
+
+	names := make([]string, 0, len(step.Extract))
+	for name := range step.Extract {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		value, _, err := shorthand.GetPath(step.Extract[name], parsed.Map(), shorthand.GetOptions{})
+		if err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("unable to extract %s: %v", name, err))
+			continue
+		}
+		if value == nil {
+			// Later steps would otherwise use a null value without any warning.
+			result.Failures = append(result.Failures, fmt.Sprintf("unable to extract %s: %s not found", name, step.Extract[name]))
+			continue
+		}
+		vars[name] = value
+	}
+
+	if len(step.Expect) == 0 {
+		if parsed.Status >= 400 {
+			result.Failures = append(result.Failures, fmt.Sprintf("unexpected status %d", parsed.Status))
+		}
+		return
+	}
+
+	// Variables are passed as values rather than substituted into the
+	// expression, so they are never parsed as part of it.
+	input := expectInput(parsed)
+	input["vars"] = vars
+	input["env"] = workflowEnv()
+	for _, expression := range step.Expect {
+		if err := checkExpectation(expression, input); err != nil {
+			result.Failures = append(result.Failures, err.Error())
+		}
+	}
+
+	return
+}
+
+// runWorkflow runs each step in order. Once a step fails, the remaining steps
+// are skipped since they may depend on it.
+func runWorkflow(ctx context.Context, wf *Workflow) []WorkflowResult {
+	// Use the same types as parsed JSON responses, e.g. `float64` rather than
+	// `int`, so variables can be compared with response values.
+	vars := map[string]any{}
+	for k, v := range wf.Vars {
+		var value any
+		encoded, _ := json.Marshal(makeJSONSafe(v))
+		json.Unmarshal(encoded, &value)
+		vars[k] = value
+	}
+
+	results := make([]WorkflowResult, 0, len(wf.Steps))
+	failed := false
+	for _, step := range wf.Steps {
+		if failed {
+			results = append(results, WorkflowResult{
+				Name:    step.Name,
+				Method:  strings.ToUpper(step.Method),
+				URI:     step.URI,
+				Skipped: true,
+			})
+			continue
+		}
+
+		result := runWorkflowStep(ctx, step, vars)
+		failed = !result.Passed()
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// writeWorkflowText writes a human-readable summary of the results.
+func writeWorkflowText(w io.Writer, wf *Workflow, results []WorkflowResult) {
+	passed, failed, skipped := 0, 0, 0
+	total := time.Duration(0)
+
+	for _, result := range results {
+		total += result.Duration
+		name := result.Name
+		if name == "" {
+			name = result.Method + " " + result.URI
+		}
+
+		switch {
+		case result.Skipped:
+			skipped++
+			fmt.Fprintf(w, "%s %s\n", au.Index(243, "SKIP"), name)
+			continue
+		case result.Passed():
+			passed++
+			fmt.Fprintf(w, "%s %s", au.Green("PASS"), name)
+		default:
+			failed++
+			fmt.Fprintf(w, "%s %s", au.Red("FAIL").Bold(), name)
+		}
+
+		if result.Status != 0 {
+			fmt.Fprintf(w, " %s", au.Index(243, fmt.Sprintf("(%d, %s)", result.Status, result.Duration.Truncate(time.Millisecond))))
+		}
+		fmt.Fprintln(w)
+
+		if result.Error != "" {
+			fmt.Fprintf(w, "     %s\n", strings.ReplaceAll(result.Error, "\n", "\n     "))
+		}
+		for _, failure := range result.Failures {
+			fmt.Fprintf(w, "     %s\n", strings.ReplaceAll(failure, "\n", "\n     "))
+		}
+	}
+
+	fmt.Fprintln(w)
+	if wf.Name != "" {
+		fmt.Fprintf(w, "%s: ", wf.Name)
+	}
+	fmt.Fprintf(w, "%d passed, %d failed, %d skipped in %s\n", passed, failed, skipped, total.Truncate(time.Millisecond))
+}
+
+type junitTestSuite struct {
+	XMLName  xml.Name        `xml:"testsuite"`
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// writeWorkflowJUnit writes the results as JUnit XML for CI systems, with
+// one test case per step.
+func writeWorkflowJUnit(w io.Writer, wf *Workflow, results []WorkflowResult) error {
+	name := wf.Name
+	if name == "" {
+		name = "workflow"
+	}
+
+	suite := junitTestSuite{
+		Name:  name,
+		Tests: len(results),
+	}
+
+	total := time.Duration(0)
+	for _, result := range results {
+		total += result.Duration
+		tc := junitTestCase{
+			Name:      result.Name,
+			Classname: name,
+			Time:      fmt.Sprintf("%.3f", result.Duration.Seconds()),
+		}
+		if tc.Name == "" {
+			tc.Name = result.Method + " " + result.URI
+		}
+
+		switch {
+		case result.Skipped:
+			suite.Skipped++
+			tc.Skipped = &junitMessage{Message: "a previous step failed"}
+		case result.Error != "":
+			suite.Errors++
+			tc.Error = &junitMessage{Message: strings.SplitN(result.Error, "\n", 2)[0], Text: result.Error}
+		case len(result.Failures) > 0:
+			suite.Failures++
+			tc.Failure = &junitMessage{Message: strings.SplitN(result.Failures[0], "\n", 2)[0], Text: strings.Join(result.Failures, "\n")}
+		}
+
+		suite.Cases = append(suite.Cases, tc)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total.Seconds())
+
+	encoded, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, encoded)
+	return err
+}
+
+// runWorkflowFile runs the workflow in a file, or stdin if the filename is
+// `-`, and reports the results as `text` or `junit`. Panics if a step failed
+// without a response, otherwise a step which did not pass sets the exit code
+// for failed expectations.
+func runWorkflowFile(filename, report string) {
+	var r io.Reader = Stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	wf, err := readWorkflow(r)
+	if err != nil {
+		panic(err)
+	}
+
+	if report != "text" && report != "junit" {
+		panic(fmt.Errorf("unknown report format %s", report))
+	}
+
+	results := runWorkflow(context.Background(), wf)
+
+	switch report {
+	case "junit":
+		if err := writeWorkflowJUnit(Stdout, wf, results); err != nil {
+			panic(err)
+		}
+	default:
+		writeWorkflowText(Stdout, wf, results)
+	}
+
+	// The results decide the exit code rather than the last HTTP status, since
+	// a step may expect an error status.
+	expectationsChecked = true
+	for i, result := range results {
+		if !result.Passed() {
+			err := fmt.Errorf("workflow failed at step %d: %s", i+1, result.Name)
+			if result.Error != "" {
+				panic(err)
+			}
+			LogError("%v", err)
+			expectationFailed = true
+			break
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/h2non/gock.v1"
+)
+
+func TestExpandVars(t *testing.T) {
+	t.Setenv("WORKFLOW_TOKEN", "secret")
+	vars := map[string]any{"id": 42.0, "name": "test", "tags": []any{"a"}}
+
+	expanded, err := expandVars("/items/${id}?name=${name}&tags=${tags}", vars)
+	assert.NoError(t, err)
+	assert.Equal(t, "/items/42?name=test&tags=[\"a\"]", expanded)
+
+	expanded, err = expandVars("Bearer ${env.WORKFLOW_TOKEN}", vars)
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer secret", expanded)
+
+	// The environment is only used with an explicit prefix.
+	_, err = expandVars("${WORKFLOW_TOKEN}", vars)
+	assert.ErrorContains(t, err, "undefined variable WORKFLOW_TOKEN")
+
+	_, err = expandVars("${env.WORKFLOW_MISSING}", vars)
+	assert.ErrorContains(t, err, "undefined environment variable WORKFLOW_MISSING")
+
+	_, err = expandVars("${missing}", vars)
+	assert.ErrorContains(t, err, "undefined variable missing")
+
+	value, err := expandValue(map[string]any{
+		"id":    "${id}",
+		"label": "item ${id}",
+		"tags":  []any{"${name}"},
+	}, vars)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"id":    42.0,
+		"label": "item 42",
+		"tags":  []any{"test"},
+	}, value)
+}
+
+func TestReadWorkflow(t *testing.T) {
+	wf, err := readWorkflow(strings.NewReader(`
+name: Smoke test
+steps:
+  - uri: example.com/items
+    body: {name: test}
+    extract:
+      id: body.id
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, "Smoke test", wf.Name)
+	assert.Equal(t, map[string]any{"name": "test"}, wf.Steps[0].Body)
+	assert.Equal(t, map[string]string{"id": "body.id"}, wf.Steps[0].Extract)
+
+	_, err = readWorkflow(strings.NewReader(`steps: []`))
+	assert.ErrorContains(t, err, "no steps")
+
+	_, err = readWorkflow(strings.NewReader(`steps: [{method: get}]`))
+	assert.ErrorContains(t, err, "step 1 has no uri")
+}
+
+func workflowServer(t *testing.T) *httptest.Server {
+	return jsonServer(t, func(r *http.Request) (int, any) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/items":
+			var body map[string]any
+			json.NewDecoder(r.Body).Decode(&body)
+			return http.StatusCreated, map[string]any{"id": 42, "name": body["name"]}
+		case r.URL.Path == "/items/42":
+			return http.StatusOK, map[string]any{
+				"id":    42,
+				"name":  "test",
+				"token": r.Header.Get("Authorization"),
+			}
+		}
+		return http.StatusNotFound, map[string]any{"title": "Not Found"}
+	})
+}
+
+func TestWorkflow(t *testing.T) {
+	gock.Off()
+	defer reset(false)
+
+	server := workflowServer(t)
+
+	t.Setenv("WORKFLOW_TOKEN", "abc123")
+	filename := writeTestFile(t, "flow.yaml", `
+name: Items
+vars:
+  base: `+server.URL+`
+  name: test
+  count: 42
+steps:
+  - name: Create item
+    method: post
+    uri: ${base}/items
+    body:
+      name: test
+    extract:
+      id: body.id
+    expect:
+      - status == 201
+      - headers.Content-Type contains json
+  - name: Get item
+    uri: ${base}/items/${id}
+    headers:
+      Authorization: Bearer ${env.WORKFLOW_TOKEN}
+    expect:
+      - body.id == vars.id
+      - body.id == vars.count
+      - body.name == vars.name
+      - body.token == "Bearer " + env.WORKFLOW_TOKEN
+`)
+
+	reset(false)
+	captured := runNoReset("run " + filename)
+	assert.Contains(t, captured, "PASS Create item (201")
+	assert.Contains(t, captured, "PASS Get item (200")
+	assert.Contains(t, captured, "Items: 2 passed, 0 failed, 0 skipped")
+	assert.NotContains(t, captured, "ERROR")
+	assert.Equal(t, 0, GetExitCode())
+}
+
+func TestWorkflowFailure(t *testing.T) {
+	gock.Off()
+	defer reset(false)
+
+	server := workflowServer(t)
+
+	filename := writeTestFile(t, "flow.yaml", `
+steps:
+  - name: Get item
+    uri: `+server.URL+`/items/42
+    expect:
+      - status == 200
+      - body.name == test
+  - name: Missing
+    uri: `+server.URL+`/missing
+`)
+
+	reset(false)
+	captured := runNoReset("run " + filename)
+	assert.Contains(t, captured, "PASS Get item")
+	assert.Contains(t, captured, "FAIL Missing (404")
+	assert.Contains(t, captured, "unexpected status 404")
+	assert.Contains(t, captured, "workflow failed at step 2")
+	assert.Equal(t, ExitCodeExpectationFailed, GetExitCode())
+	expectationFailed, expectationsChecked = false, false
+
+	filename = writeTestFile(t, "flow.yaml", `
+name: Items
+steps:
+  - name: Get item
+    uri: `+server.URL+`/items/42
+    expect:
+      - body.name == other
+  - name: Missing
+    uri: `+server.URL+`/missing
+`)
+
+	reset(false)
+	captured = runNoReset("run --rsh-report junit " + filename)
+	start := strings.Index(captured, "<?xml")
+	end := strings.Index(captured, "</testsuite>")
+	require.True(t, start >= 0 && end > start, captured)
+
+	var suite junitTestSuite
+	require.NoError(t, xml.Unmarshal([]byte(captured[start:end+len("</testsuite>")]), &suite))
+	assert.Equal(t, "Items", suite.Name)
+	assert.Equal(t, 2, suite.Tests)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Equal(t, 1, suite.Skipped)
+	require.NotNil(t, suite.Cases[0].Failure)
+	assert.Equal(t, `expected body.name == other, but body.name is "test"`, suite.Cases[0].Failure.Message)
+	assert.NotNil(t, suite.Cases[1].Skipped)
+	expectationFailed, expectationsChecked = false, false
+
+	// Extracting a missing value fails the step rather than passing null to
+	// later steps.
+	filename = writeTestFile(t, "flow.yaml", `
+steps:
+  - name: Get item
+    uri: `+server.URL+`/items/42
+    extract:
+      owner: body.owner
+  - name: Get owner
+    uri: `+server.URL+`/users/${owner}
+`)
+
+	reset(false)
+	captured = runNoReset("run " + filename)
+	assert.Contains(t, captured, "FAIL Get item (200")
+	assert.Contains(t, captured, "unable to extract owner: body.owner not found")
+	assert.Contains(t, captured, "SKIP Get owner")
+	assert.Equal(t, ExitCodeExpectationFailed, GetExitCode())
+	expectationFailed, expectationsChecked = false, false
+}
@@ -212,6 +212,7 @@ type AuthorizationCodeTokenSource struct {
 	RedirectURL    string
 	EndpointParams *url.Values
 	Scopes         []string
+	Client         *http.Client
 }
 
 func (ac *AuthorizationCodeTokenSource) getRedirectUrl() string {
@@ -325,7 +326,7 @@ func (ac *AuthorizationCodeTokenSource) Token() (*oauth2.Token, error) {
 		payload.Set("client_secret", ac.ClientSecret)
 	}
 
-	return requestToken(ac.TokenURL, payload.Encode())
+	return requestToken(ac.Client, ac.TokenURL, payload.Encode())
 }
 
 // AuthorizationCodeHandler sets up the OAuth 2.0 authorization code with PKCE authentication
@@ -365,18 +366,24 @@ func (h *AuthorizationCodeHandler) OnRequest(request *http.Request, key string,
 			RedirectURL:    params["redirect_url"],
 			EndpointParams: &endpointParams,
 			Scopes:         strings.Split(params["scopes"], ","),
+			Client:         cli.ClientFromContext(request.Context()),
 		}
 
 		// Try to get a cached refresh token from the current profile and use
 		// it to wrap the auth code token source with a refreshing source.
 		refreshKey := key + ".refresh"
+		unlock := cli.LockCache()
+		refreshToken := cli.Cache.GetString(refreshKey)
+		unlock()
+
 		refreshSource := RefreshTokenSource{
 			ClientID:       params["client_id"],
 			TokenURL:       params["token_url"],
 			Scopes:         strings.Split(params["scopes"], ","),
 			EndpointParams: &endpointParams,
-			RefreshToken:   cli.Cache.GetString(refreshKey),
+			RefreshToken:   refreshToken,
 			TokenSource:    source,
+			Client:         cli.ClientFromContext(request.Context()),
 		}
 
 		return TokenHandler(&refreshSource, key, request)
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/rest-sh/restish/cli"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 )
 
@@ -54,7 +55,7 @@ func (h *ClientCredentialsHandler) OnRequest(request *http.Request, key string,
 			TokenURL:       params["token_url"],
 			EndpointParams: endpointParams,
 			Scopes:         strings.Split(params["scopes"], ","),
-		}).TokenSource(context.Background())
+		}).TokenSource(context.WithValue(context.Background(), oauth2.HTTPClient, cli.ClientFromContext(request.Context())))
 
 		return TokenHandler(source, key, request)
 	}
@@ -13,10 +13,14 @@ var ErrInvalidProfile = errors.New("invalid profile")
 
 // TokenHandler takes a token source, gets a token, and modifies a request to
 // add the token auth as a header. Uses the CLI cache to store tokens on a per-
-// profile basis between runs.
+// profile basis between runs. The cache is locked while getting a token, so
+// concurrent requests wait for and then reuse the same token.
 func TokenHandler(source oauth2.TokenSource, key string, request *http.Request) error {
 	var cached *oauth2.Token
 
+	unlock := cli.LockCache()
+	defer unlock()
+
 	// Load any existing token from the CLI's cache file.
 	expiresKey := key + ".expires"
 	typeKey := key + ".type"
@@ -1,6 +1,7 @@
 package oauth
 
 import (
+	"net/http"
 	"net/url"
 	"strings"
 
@@ -31,6 +32,9 @@ type RefreshTokenSource struct {
 	// TokenSource to wrap to fetch new tokens if the refresh token is missing or
 	// did not work to get a new token.
 	TokenSource oauth2.TokenSource
+
+	// Client is used to make token requests. Defaults to `http.DefaultClient`.
+	Client *http.Client
 }
 
 // Token generates a new token using either a refresh token or by falling
@@ -52,7 +56,7 @@ func (ts *RefreshTokenSource) Token() (*oauth2.Token, error) {
 			}
 		}
 
-		token, err := requestToken(ts.TokenURL, refreshParams.Encode())
+		token, err := requestToken(ts.Client, ts.TokenURL, refreshParams.Encode())
 		if err == nil {
 			return token, err
 		}
@@ -24,8 +24,13 @@ type tokenResponse struct {
 }
 
 // requestToken from the given URL with the given payload. This can be used
-// for many different grant types and will return a parsed token.
-func requestToken(tokenURL, payload string) (*oauth2.Token, error) {
+// for many different grant types and will return a parsed token. If client is
+// nil then `http.DefaultClient` is used.
+func requestToken(client *http.Client, tokenURL, payload string) (*oauth2.Token, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
 	req, err := http.NewRequest("POST", tokenURL, strings.NewReader(payload))
 	if err != nil {
 		return nil, err
@@ -36,7 +41,7 @@ func requestToken(tokenURL, payload string) (*oauth2.Token, error) {
 	cli.LogDebugRequest(req)
 
 	start := time.Now()
-	res, err := http.DefaultClient.Do(req)
+	res, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -55,6 +55,9 @@ const (
 
 	// Custom auto-configuration for CLIs
 	ExtCLIConfig = "x-cli-config"
+
+	// Describe how to auto-paginate an operation's object responses
+	ExtPagination = "x-cli-pagination"
 )
 
 type autoConfig struct {
@@ -360,6 +363,7 @@ func openapiOperation(cmd *cobra.Command, method string, uriTemplate *url.URL, p
 
 	desc := getExtOr(op.Extensions, ExtDescription, op.Description)
 	hidden := getExtOr(op.Extensions, ExtHidden, false)
+	pagination := getExtOr[*cli.PaginationConfig](op.Extensions, ExtPagination, nil)
 
 	if len(pathParams) > 0 {
 		desc += "\n## Argument Schema:\n```schema\n{\n"
@@ -577,6 +581,7 @@ func openapiOperation(cmd *cobra.Command, method string, uriTemplate *url.URL, p
 		Examples:      examples,
 		Hidden:        hidden,
 		Deprecated:    dep,
+		Pagination:    pagination,
 	}
 }
 